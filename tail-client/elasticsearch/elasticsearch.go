@@ -2,7 +2,9 @@ package elasticsearch
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/sciffer/sse"
 	"gopkg.in/olivere/elastic.v6"
@@ -15,31 +17,25 @@ type elasticsearch struct {
 	filters      []elastic.Query
 }
 
-func NewElasticsearch(cluster string, indices []string, service string, relativetime string) *elasticsearch {
+func NewElasticsearch(cluster string, indices []string, services []string, relativetime string) *elasticsearch {
 	if newClient, err := elastic.NewClient(elastic.SetURL(cluster)); err == nil {
-		return &elasticsearch{client: *newClient, indices: indices, relativetime: relativetime, filters: []elastic.Query{elastic.NewTermQuery("app.keyword", service)}}
+		apps := make([]interface{}, len(services))
+		for i, service := range services {
+			apps[i] = service
+		}
+		return &elasticsearch{client: *newClient, indices: indices, relativetime: relativetime, filters: []elastic.Query{elastic.NewTermsQuery("app.keyword", apps...)}}
 	}
 	log.Fatalf("Failed to create client for:%s", cluster)
 	return nil
 }
 
+// Filter adds query to the filters of the query, like the queries of the -where conditions
+func (e *elasticsearch) Filter(query elastic.Query) {
+	e.filters = append(e.filters, query)
+}
+
 func (e *elasticsearch) Query2sse(outputStream chan *sse.Event, terms map[string]interface{}, msgCount int) error {
-	//Assemble query from terms list
-	if len(terms) > 0 {
-		for k, v := range terms {
-			if _, ok := v.([]interface{}); ok {
-				e.filters = append(e.filters, elastic.NewTermsQuery(k, v.([]interface{})...))
-			} else if _, ok := v.([]string); ok {
-				tmp := make([]interface{}, len(v.([]string)))
-				for i, val := range v.([]string) {
-					tmp[i] = val
-				}
-				e.filters = append(e.filters, elastic.NewTermsQuery(k, tmp...))
-			} else {
-				e.filters = append(e.filters, elastic.NewTermsQuery(k, v))
-			}
-		}
-	}
+	e.addTerms(terms)
 
 	//Perform query
 	ctx := context.Background()
@@ -62,3 +58,57 @@ func (e *elasticsearch) Query2sse(outputStream chan *sse.Event, terms map[string
 
 	return err
 }
+
+// Backfill2sse writes all the messages from the relative time up to until, oldest first. The window is paged
+// through pageSize messages at a time with search_after, so it is complete however many messages it holds.
+// On error the messages of the previous pages were already written.
+func (e *elasticsearch) Backfill2sse(outputStream chan *sse.Event, terms map[string]interface{}, until time.Time, pageSize int) error {
+	e.addTerms(terms)
+	window := elastic.NewRangeQuery("@timestamp").Gt(e.relativetime).Lte(until.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+	query := elastic.NewBoolQuery().Must(window).Filter(e.filters...)
+	var after []interface{}
+	for {
+		search := e.client.Search().
+			Index(e.indices...).
+			Query(query).
+			Sort("@timestamp", true).
+			Sort("_id", true). // tie breaker, messages logged at the same time are neither skipped nor repeated
+			Size(pageSize)
+		if after != nil {
+			search = search.SearchAfter(after...)
+		}
+		result, err := search.Do(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, event := range result.Hits.Hits {
+			if data, err := event.Source.MarshalJSON(); err == nil {
+				outputStream <- &sse.Event{Data: data}
+			}
+			after = event.Sort
+		}
+		if len(result.Hits.Hits) < pageSize {
+			return nil
+		}
+		if after == nil {
+			return fmt.Errorf("elasticsearch returned no sort values to page from")
+		}
+	}
+}
+
+// addTerms adds terms queries of the terms list to the filters
+func (e *elasticsearch) addTerms(terms map[string]interface{}) {
+	for k, v := range terms {
+		if _, ok := v.([]interface{}); ok {
+			e.filters = append(e.filters, elastic.NewTermsQuery(k, v.([]interface{})...))
+		} else if _, ok := v.([]string); ok {
+			tmp := make([]interface{}, len(v.([]string)))
+			for i, val := range v.([]string) {
+				tmp[i] = val
+			}
+			e.filters = append(e.filters, elastic.NewTermsQuery(k, tmp...))
+		} else {
+			e.filters = append(e.filters, elastic.NewTermsQuery(k, v))
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenColon
+	tokenLParen
+	tokenRParen
+	tokenAnd
+	tokenOr
+	tokenNot
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// describe returns the token as shown in syntax errors
+func (t token) describe() string {
+	switch t.kind {
+	case tokenEOF:
+		return "end of query"
+	case tokenString:
+		return fmt.Sprintf("%q", t.value)
+	}
+	return "'" + t.value + "'"
+}
+
+// SyntaxError is an error of a query at Pos(a byte offset), its message points at the error position.
+type SyntaxError struct {
+	Query   string
+	Pos     int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at column %d\n\t%s\n\t%s^", e.Message, e.Pos+1, e.Query, strings.Repeat(" ", e.Pos))
+}
+
+// lex splits the query into tokens, AND, OR and NOT are keywords in upper case only
+func lex(query string) ([]token, error) {
+	tokens := []token{}
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == ':':
+			tokens = append(tokens, token{kind: tokenColon, value: ":", pos: i})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case c == '"':
+			value := []byte{}
+			start := i
+			for i++; ; i++ {
+				if i >= len(query) {
+					return nil, &SyntaxError{Query: query, Pos: start, Message: "unterminated quoted value"}
+				}
+				if query[i] == '\\' && i+1 < len(query) {
+					i++
+				} else if query[i] == '"' {
+					break
+				}
+				value = append(value, query[i])
+			}
+			i++
+			tokens = append(tokens, token{kind: tokenString, value: string(value), pos: start})
+		default:
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n\r:()\"", rune(query[i])) {
+				i++
+			}
+			word := token{kind: tokenWord, value: query[start:i], pos: start}
+			switch word.value {
+			case "AND":
+				word.kind = tokenAnd
+			case "OR":
+				word.kind = tokenOr
+			case "NOT":
+				word.kind = tokenNot
+			}
+			tokens = append(tokens, word)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(query)}), nil
+}
+
+// parser is a recursive descent parser of:
+//
+//	or      = and { "OR" and }
+//	and     = not { ["AND"] not }
+//	not     = "NOT" not | primary
+//	primary = "(" or ")" | field ":" value | field ":" "(" or ")" | value(within a field group)
+type parser struct {
+	query  string
+	tokens []token
+	next   int
+}
+
+// Parse compiles query, it returns a *SyntaxError when the query is invalid
+func Parse(query string) (Node, error) {
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{query: query, tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		return nil, p.errorf(p.peek(), "empty query")
+	}
+	node, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		if t.kind == tokenRParen {
+			return nil, p.errorf(t, "unbalanced ')'")
+		}
+		return nil, p.errorf(t, "unexpected %s", t.describe())
+	}
+	return node, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) consume() token {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) errorf(t token, format string, values ...interface{}) error {
+	return &SyntaxError{Query: p.query, Pos: t.pos, Message: fmt.Sprintf(format, values...)}
+}
+
+// parseOr parses a disjunction, field is the field of the enclosing field group, empty at the top level
+func (p *parser) parseOr(field string) (Node, error) {
+	node, err := p.parseAnd(field)
+	if err != nil {
+		return nil, err
+	}
+	or := Or{node}
+	for p.peek().kind == tokenOr {
+		p.consume()
+		if node, err = p.parseAnd(field); err != nil {
+			return nil, err
+		}
+		or = append(or, node)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+func (p *parser) parseAnd(field string) (Node, error) {
+	node, err := p.parseNot(field)
+	if err != nil {
+		return nil, err
+	}
+	and := And{node}
+	for {
+		switch p.peek().kind {
+		case tokenAnd:
+			p.consume()
+		case tokenWord, tokenString, tokenLParen, tokenNot:
+			// terms next to each other are ANDed
+		default:
+			if len(and) == 1 {
+				return and[0], nil
+			}
+			return and, nil
+		}
+		if node, err = p.parseNot(field); err != nil {
+			return nil, err
+		}
+		and = append(and, node)
+	}
+}
+
+func (p *parser) parseNot(field string) (Node, error) {
+	if p.peek().kind == tokenNot {
+		p.consume()
+		node, err := p.parseNot(field)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Node: node}, nil
+	}
+	return p.parsePrimary(field)
+}
+
+func (p *parser) parsePrimary(field string) (Node, error) {
+	t := p.consume()
+	switch t.kind {
+	case tokenLParen:
+		node, err := p.parseOr(field)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing.kind != tokenRParen {
+			return nil, p.errorf(closing, "expected ')' to close the '(' at column %d, found %s", t.pos+1, closing.describe())
+		}
+		p.consume()
+		return node, nil
+	case tokenWord, tokenString:
+		if p.peek().kind == tokenColon {
+			if field != "" {
+				return nil, p.errorf(t, "field %s within the values of field %s", t.describe(), field)
+			}
+			if t.kind == tokenString {
+				return nil, p.errorf(t, "field names can't be quoted")
+			}
+			p.consume()
+			return p.parseValue(t.value)
+		}
+		if field == "" {
+			return nil, p.errorf(t, "expected field:value, like level:ERROR, found %s", t.describe())
+		}
+		return NewTerm(field, t.value, t.kind == tokenString), nil
+	case tokenEOF:
+		return nil, p.errorf(t, "unexpected end of query, expected a term")
+	}
+	return nil, p.errorf(t, "unexpected %s, expected a term", t.describe())
+}
+
+// parseValue parses the value or the group of values of field, after the colon
+func (p *parser) parseValue(field string) (Node, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokenWord, tokenString:
+		p.consume()
+		return NewTerm(field, t.value, t.kind == tokenString), nil
+	case tokenLParen:
+		return p.parsePrimary(field)
+	}
+	return nil, p.errorf(t, "expected a value of field %s, found %s", field, t.describe())
+}
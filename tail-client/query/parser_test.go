@@ -0,0 +1,226 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gopkg.in/olivere/elastic.v6"
+)
+
+// show renders node with explicit parentheses, so the tests pin the structure built by the parser
+func show(node Node) string {
+	switch n := node.(type) {
+	case And:
+		return "(" + join(n, " AND ") + ")"
+	case Or:
+		return "(" + join(n, " OR ") + ")"
+	case Not:
+		return "NOT " + show(n.Node)
+	case *Term:
+		if n.Phrase {
+			return fmt.Sprintf("%s:%q", n.Field, n.Value)
+		}
+		return n.Field + ":" + n.Value
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+func join(nodes []Node, separator string) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = show(node)
+	}
+	return strings.Join(parts, separator)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`level:ERROR`, `level:ERROR`},
+		{`a:1 AND b:2 AND c:3`, `(a:1 AND b:2 AND c:3)`},
+		{`a:1 OR b:2 AND c:3`, `(a:1 OR (b:2 AND c:3))`},
+		{`a:1 AND b:2 OR c:3`, `((a:1 AND b:2) OR c:3)`},
+		{`a:1 b:2 OR c:3`, `((a:1 AND b:2) OR c:3)`},
+		{`NOT a:1 AND b:2`, `(NOT a:1 AND b:2)`},
+		{`NOT a:1 OR b:2`, `(NOT a:1 OR b:2)`},
+		{`NOT (a:1 OR b:2)`, `NOT (a:1 OR b:2)`},
+		{`NOT NOT a:1`, `NOT NOT a:1`},
+		{`(a:1 OR b:2) c:3`, `((a:1 OR b:2) AND c:3)`},
+		{`level:(ERROR OR WARN)`, `(level:ERROR OR level:WARN)`},
+		{`level:(ERROR OR (WARN AND NOT INFO))`, `(level:ERROR OR (level:WARN AND NOT level:INFO))`},
+		{`level:(ERROR WARN)`, `(level:ERROR AND level:WARN)`},
+		{`pod:checkout-7* env:prod cluster:eu podid:1 rev:v2`, `(kubernetes.pod_name:checkout-7* AND kubernetes.labels.environment:prod AND kubernetes.labels.kubeCluster:eu AND kubernetes.pod_id:1 AND kubernetes.labels.version:v2)`},
+		{`contextMap.tenantId:t-1`, `contextMap.tenantId:t-1`},
+		{`message:"health check"`, `message:"health check"`},
+		{`message:"say \"hi\" \\ (now):"`, `message:"say \"hi\" \\ (now):"`},
+		{`message:"and OR not"`, `message:"and OR not"`},
+		{`level:error or:x`, `(level:error AND or:x)`},
+		{" \tlevel : ERROR\n", `level:ERROR`},
+		{
+			`level:(ERROR OR WARN) AND pod:checkout-7* AND NOT message:"health check"`,
+			`((level:ERROR OR level:WARN) AND kubernetes.pod_name:checkout-7* AND NOT message:"health check")`,
+		},
+	}
+	for _, test := range tests {
+		node, err := Parse(test.query)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.query, err)
+			continue
+		}
+		if got := show(node); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		message string
+		column  int
+	}{
+		{``, "empty query", 1},
+		{`   `, "empty query", 4},
+		{`ERROR`, "expected field:value", 1},
+		{`level:`, "expected a value of field level", 7},
+		{`level:)`, "expected a value of field level", 7},
+		{`level:(ERROR OR`, "unexpected end of query", 16},
+		{`(level:ERROR`, "expected ')' to close the '(' at column 1", 13},
+		{`level:ERROR)`, "unbalanced ')'", 12},
+		{`level:"ERROR`, "unterminated quoted value", 7},
+		{`level:(pod:x)`, "field 'pod' within the values of field level", 8},
+		{`"level":ERROR`, "field names can't be quoted", 1},
+		{`a:1 OR OR b:2`, "unexpected 'OR', expected a term", 8},
+		{`a:1 AND`, "unexpected end of query", 8},
+		{`NOT`, "unexpected end of query", 4},
+		{`a:1 :b`, "unexpected ':'", 5},
+		{`a:b:c`, "unexpected ':'", 4},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.query)
+		syntaxErr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("%q: got %v, want a syntax error", test.query, err)
+			continue
+		}
+		if !strings.Contains(syntaxErr.Message, test.message) || syntaxErr.Pos+1 != test.column {
+			t.Errorf("%q: got %q at column %d, want %q at column %d", test.query, syntaxErr.Message, syntaxErr.Pos+1, test.message, test.column)
+		}
+		if !strings.Contains(err.Error(), fmt.Sprintf("at column %d\n", test.column)) {
+			t.Errorf("%q: error doesn't tell the column: %s", test.query, err)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	var msg map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"level": "WARN",
+		"message": "GET /Health Check took 3ms",
+		"code": 503,
+		"ok": false,
+		"tags": ["api", "EVENT"],
+		"kubernetes": {"pod_name": "checkout-7f9c", "labels": {"environment": "prod"}},
+		"path": "a.b"
+	}`), &msg)
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{`level:WARN`, true},
+		{`level:warn`, false},
+		{`level:WA`, false},
+		{`level:(ERROR OR WARN)`, true},
+		{`level:(ERROR OR INFO)`, false},
+		{`pod:checkout-7*`, true},
+		{`pod:checkout-8*`, false},
+		{`pod:checkout-7???`, true},
+		{`pod:checkout-7??`, false},
+		{`pod:*7f9c`, true},
+		{`path:a.b`, true},
+		{`path:a?b`, true},
+		{`path:a.*`, true},
+		{`path:ax*`, false},
+		{`message:"health check"`, true},
+		{`message:"HEALTH CHECK"`, true},
+		{`message:"health  check"`, true},
+		{`message:"health-check"`, true},
+		{`message:"heal"`, false},
+		{`message:"check health"`, false},
+		{`message:"took 3ms"`, true},
+		{`message:"3"`, false},
+		{`message:"/"`, false},
+		{`message:Health`, false},
+		{`code:503`, true},
+		{`ok:false`, true},
+		{`tags:EVENT`, true},
+		{`tags:api tags:EVENT`, true},
+		{`tags:(LOG OR EVENT)`, true},
+		{`env:prod`, true},
+		{`missing:x`, false},
+		{`NOT missing:x`, true},
+		{`missing:*`, false},
+		{`level:*`, true},
+		{`kubernetes:x`, false},
+		{`level:WARN AND NOT message:"health check"`, false},
+		{`level:ERROR OR code:503`, true},
+		{`level:(ERROR OR WARN) AND pod:checkout-7* AND NOT message:"health check"`, false},
+		{`level:(ERROR OR WARN) AND pod:checkout-7* AND NOT message:"timeout"`, true},
+	}
+	for _, test := range tests {
+		node, err := Parse(test.query)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", test.query, err)
+			continue
+		}
+		if got := node.Match(msg); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.query, got, test.want)
+		}
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"GET /Health Check took 3ms", "get|health|check|took|3ms"},
+		{"user_id=42, host=example.com.", "user_id|42|host|example.com"},
+		{"don't stop", "don't|stop"},
+		{"Überweisung fehlgeschlagen", "überweisung|fehlgeschlagen"},
+		{" -- ", ""},
+	}
+	for _, test := range tests {
+		if got := strings.Join(words(test.text), "|"); got != test.want {
+			t.Errorf("%q: got %s, want %s", test.text, got, test.want)
+		}
+	}
+}
+
+func TestTermQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`level:ERROR`, "*elastic.TermQuery"},
+		{`pod:checkout-7*`, "*elastic.WildcardQuery"},
+		{`message:"health check"`, "*elastic.MatchPhraseQuery"},
+		{`a:1 b:2`, "*elastic.BoolQuery"},
+		{`a:1 OR b:2`, "*elastic.BoolQuery"},
+		{`NOT a:1`, "*elastic.BoolQuery"},
+	}
+	for _, test := range tests {
+		node, err := Parse(test.query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.query, err)
+		}
+		var query elastic.Query = node.Query()
+		if got := fmt.Sprintf("%T", query); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.query, got, test.want)
+		}
+	}
+}
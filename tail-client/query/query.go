@@ -0,0 +1,230 @@
+// Package query implements the query language of tail-client, like:
+//
+//	level:(ERROR OR WARN) AND pod:checkout-7* AND NOT message:"health check"
+//
+// Terms are field:value pairs over dotted json paths, combined with AND, OR, NOT and parentheses,
+// terms next to each other are ANDed. A field may be applied to a group of values, like level:(ERROR OR WARN).
+// Unquoted values match the whole value of the field, case-sensitive, and may use the * and ? wildcards.
+// Quoted values are phrases: their words must follow each other in the field, ignoring case and punctuation.
+// Messages missing a field don't match its terms.
+//
+// A query compiles both to a predicate over the decoded json messages and to an elasticsearch query.
+// As in the -where queries, unquoted values are matched against the keyword sub-field of the field, so
+// fields without one(numbers, booleans) only match live. Phrases are match_phrase queries on the analyzed
+// field, which the live predicate mirrors by splitting the values into words like the standard analyzer.
+package query
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/olivere/elastic.v6"
+)
+
+// aliases are the short names of the common fields, the same as the ctail servers filter parameters
+var aliases = map[string]string{
+	"pod":     "kubernetes.pod_name",
+	"podid":   "kubernetes.pod_id",
+	"env":     "kubernetes.labels.environment",
+	"rev":     "kubernetes.labels.version",
+	"cluster": "kubernetes.labels.kubeCluster",
+}
+
+// Node is a compiled query or part of it
+type Node interface {
+	// Match returns true if the decoded json message matches
+	Match(msg map[string]interface{}) bool
+	// Query returns the elasticsearch query matching the same messages
+	Query() elastic.Query
+}
+
+// And matches when all of its nodes match, an empty And matches all messages
+type And []Node
+
+func (a And) Match(msg map[string]interface{}) bool {
+	for _, node := range a {
+		if !node.Match(msg) {
+			return false
+		}
+	}
+	return true
+}
+
+func (a And) Query() elastic.Query {
+	return elastic.NewBoolQuery().Filter(queries(a)...)
+}
+
+// Or matches when any of its nodes match
+type Or []Node
+
+func (o Or) Match(msg map[string]interface{}) bool {
+	for _, node := range o {
+		if node.Match(msg) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Or) Query() elastic.Query {
+	return elastic.NewBoolQuery().Should(queries(o)...).MinimumNumberShouldMatch(1)
+}
+
+// Not matches when its node does not
+type Not struct {
+	Node Node
+}
+
+func (n Not) Match(msg map[string]interface{}) bool {
+	return !n.Node.Match(msg)
+}
+
+func (n Not) Query() elastic.Query {
+	return elastic.NewBoolQuery().MustNot(n.Node.Query())
+}
+
+// Term matches the messages whose Field(a dotted json path) has Value, or contains its words for a Phrase
+type Term struct {
+	Field  string
+	Value  string
+	Phrase bool
+	path   []string
+	regex  *regexp.Regexp // for wildcard values
+	words  []string       // for phrases
+}
+
+// NewTerm returns the term of field(an alias or a dotted json path) and value, phrase for quoted values
+func NewTerm(field string, value string, phrase bool) *Term {
+	if path, ok := aliases[field]; ok {
+		field = path
+	}
+	t := &Term{Field: field, Value: value, Phrase: phrase, path: strings.Split(field, ".")}
+	if phrase {
+		t.words = words(value)
+	}
+	if !phrase && strings.ContainsAny(value, "*?") {
+		pattern := regexp.QuoteMeta(value)
+		pattern = strings.Replace(pattern, `\*`, ".*", -1)
+		pattern = strings.Replace(pattern, `\?`, ".", -1)
+		t.regex = regexp.MustCompile("^(?s:" + pattern + ")$")
+	}
+	return t
+}
+
+func (t *Term) Match(msg map[string]interface{}) bool {
+	for _, value := range Values(msg, t.path) {
+		switch {
+		case t.Phrase:
+			if containsWords(words(value), t.words) {
+				return true
+			}
+		case t.regex != nil:
+			if t.regex.MatchString(value) {
+				return true
+			}
+		case value == t.Value:
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Term) Query() elastic.Query {
+	switch {
+	case t.Phrase:
+		return elastic.NewMatchPhraseQuery(t.Field, t.Value)
+	case t.regex != nil:
+		return elastic.NewWildcardQuery(t.Field+".keyword", t.Value)
+	}
+	return elastic.NewTermQuery(t.Field+".keyword", t.Value)
+}
+
+// words splits text into lowercase words the way the elasticsearch standard analyzer does in the common
+// cases: runs of letters, digits and _, kept together across a . or ' between them, like example.com or don't.
+func words(text string) []string {
+	runes := []rune(strings.ToLower(text))
+	isWord := func(i int) bool {
+		return i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_')
+	}
+	result := []string{}
+	start := -1
+	for i := 0; i <= len(runes); i++ {
+		inWord := isWord(i) || start >= 0 && i < len(runes) && (runes[i] == '.' || runes[i] == '\'') && isWord(i+1)
+		switch {
+		case inWord && start < 0:
+			start = i
+		case !inWord && start >= 0:
+			result = append(result, string(runes[start:i]))
+			start = -1
+		}
+	}
+	return result
+}
+
+// containsWords returns true if phrase follows each other in text, a phrase without words matches nothing
+// like a match_phrase query.
+func containsWords(text []string, phrase []string) bool {
+	if len(phrase) == 0 {
+		return false
+	}
+	for i := 0; i+len(phrase) <= len(text); i++ {
+		j := 0
+		for j < len(phrase) && text[i+j] == phrase[j] {
+			j++
+		}
+		if j == len(phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+func queries(nodes []Node) []elastic.Query {
+	result := make([]elastic.Query, len(nodes))
+	for i, node := range nodes {
+		result[i] = node.Query()
+	}
+	return result
+}
+
+// Values returns the scalar values found at path of msg as strings, the elements of arrays included.
+// Numbers and booleans are formatted the way they are written in queries.
+func Values(msg map[string]interface{}, path []string) []string {
+	var current interface{} = msg
+	for _, key := range path {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if current, ok = object[key]; !ok {
+			return nil
+		}
+	}
+	if array, ok := current.([]interface{}); ok {
+		values := []string{}
+		for _, element := range array {
+			if value, ok := scalarString(element); ok {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+	if value, ok := scalarString(current); ok {
+		return []string{value}
+	}
+	return nil
+}
+
+func scalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
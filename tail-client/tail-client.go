@@ -3,8 +3,12 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/sciffer/tail/tail-client/tailclient"
 	ctemplate "github.com/sciffer/tail/tail-client/template"
@@ -13,14 +17,25 @@ import (
 var (
 	version string
 
-	service         = flag.String("service", "", "The service name you want to tail")
+	service         = flag.String("service", "", "The service name/s you want to tail, if more than 1 use comma as seperator - glob patterns like billing-* are supported")
+	owner           = flag.String("owner", "", "Tail all the services owned by owner, along with the -service ones")
+	color           = flag.String("color", "auto", "Whether to color the service prefix when tailing several services and the -grep matches: auto(when printing to a terminal), always or never")
 	clusters        = flag.String("cluster", "", "The cluster/s name to filter by, if set only messages with matching kubecluster pod labels will show up")
 	pods            = flag.String("pod", "", "The pod name/s you want to tail, if more than 1 use comma as seperator")
 	env             = flag.String("env", "", "The environment you want to tail, like: prod, stg, etc...")
 	podid           = flag.String("podid", "", "The pod id you want to tail")
 	rev             = flag.String("rev", "", "The revision/version to tail, filter based on the version field")
+	levels          = flag.String("level", "", "The log level/s you want to tail, like: ERROR,WARN - if more than 1 use comma as seperator")
 	servers         = flag.String("server", "tail1:8080,tail2:8080", "The comma delimited list of event endpoints(<server>:<port>) to connect to.")
 	uri             = flag.String("uri", "/events", "The uri prefix used for events streaming")
+	transport       = flag.String("transport", "sse", "The transport of the live streams: sse, ws(WebSocket) or grpc, servers that don't support it fall back to sse")
+	grpcPort        = flag.String("grpc-port", "9090", "The port of the servers gRPC API(for -transport grpc only)")
+	token           = flag.String("token", "", "The bearer token(static token or JWT) to authenticate to the servers with")
+	tokenFile       = flag.String("token-file", "", "File holding the bearer token to authenticate to the servers with, -token takes precedence")
+	useTLS          = flag.Bool("tls", false, "Whether to connect to the servers over TLS(https, wss and gRPC over TLS), implied by -ca and -cert")
+	caFile          = flag.String("ca", "", "PEM CA certificates file to verify the servers with, the system CAs are used when empty")
+	certFile        = flag.String("cert", "", "PEM client certificate file, for servers requiring client certificates - requires -key")
+	keyFile         = flag.String("key", "", "PEM private key file of -cert")
 	pretty          = flag.Bool("pretty", false, "Whether to turn on pretty print of json")
 	msgOnly         = flag.Bool("msg-only", false, "Whether to print only the message with timestamp and podname")
 	isEvents        = flag.Bool("events", false, "Whether see events instead of logs, defaults to false.")
@@ -32,17 +47,41 @@ var (
 	indices         = flag.String("indices", "logs-*", "Comma delimited list of index patterns(for history only)")
 	eventsindices   = flag.String("eventsindices", "events-*", "Comma delimited list of events index patterns(for history only)")
 	history         = flag.Bool("history", false, "query events from history/elasticsearch, instead of live events")
+	followFrom      = flag.String("follow-from", "", "Elasticsearch6 relative time to backfill from before following live events, like: now-15m")
+	followOverlap   = flag.Duration("follow-overlap", time.Minute, "How far back live events are requested when switching from backfill to live, duplicates are dropped(for follow only)")
 	maxMessages     = flag.Int("max-msg", 10000, "The maximum amount of messages to display(for history only)")
 	showFields      = flag.Bool("show-fields", false, "show list of fields")
+	queryArg        = flag.String("query", "", "A query on the messages fields, like: level:(ERROR OR WARN) AND pod:checkout-7* AND NOT message:\"health check\", unquoted values match exactly(against the keyword sub-fields in elasticsearch, so numbers and booleans only match live) and quoted phrases match words ignoring case")
+	grepArg         = flag.String("grep", "", "Print only the messages matching the regular expression, matches are highlighted in the -msg-only output")
+	grepInverted    = flag.String("grep-v", "", "Print only the messages not matching the regular expression")
+	grepField       = flag.String("grep-field", "message", "The dotted json path of the field -grep and -grep-v match against")
+	ignoreCase      = flag.Bool("i", false, "Whether -grep and -grep-v ignore case")
+	afterContext    = flag.Int("A", 0, "The number of messages of the same pod to print after every -grep match")
+	beforeContext   = flag.Int("B", 0, "The number of messages of the same pod to print before every -grep match")
+	contextLines    = flag.Int("C", 0, "The number of messages of the same pod to print around every -grep match, unless -A or -B are set")
+	where           conditionList
 )
 
-func includes(arr []string, elem string) bool {
-	for _, element := range arr {
-		if element == elem {
-			return true
-		}
-	}
-	return false
+func init() {
+	flag.Var(&where, "where", "A condition on a dotted json path: key=value, key!=value, key=~regex or 'key in (a,b)', like: kubernetes.labels.team=payments - can be repeated")
+}
+
+// conditionList collects the values of a repeated flag
+type conditionList []string
+
+func (l *conditionList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *conditionList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// isTerminal returns true if file is a terminal, rather than a pipe or a regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
 func main() {
@@ -56,18 +95,65 @@ func main() {
 		os.Exit(0)
 	}
 
-	client := ctailclient.NewCtailClient(*servers, *uri, *service, *fieldsArg, *history, *timezone, *bufferSize)
+	if *history && *followFrom != "" {
+		printUsageErrorAndExit("-history and -follow-from can't be used together")
+	}
 
-	services := client.GetServices([]string{})
-	if *service == "" {
-		printUsageErrorAndExit("-service is required, please specify one of the following services: " + strings.Join(services, " ,"))
-	} else {
-		if !includes(services, *service) {
-			printUsageErrorAndExit("-service not found, please specify one of the following services: " + strings.Join(services, " ,"))
+	client := ctailclient.NewCtailClient(*servers, *uri, *service, *fieldsArg, *history, *timezone, *bufferSize)
+	client.SetFollow(*followFrom != "")
+	if *useTLS || *caFile != "" || *certFile != "" {
+		client.SetTLS(*caFile, *certFile, *keyFile)
+	}
+	if *transport != "sse" && *transport != "ws" && *transport != "grpc" {
+		printUsageErrorAndExit("-transport should be `sse`, `ws` or `grpc`")
+	}
+	client.SetTransport(*transport, *grpcPort)
+	if *token != "" {
+		client.SetToken(*token)
+	} else if *tokenFile != "" {
+		content, err := ioutil.ReadFile(*tokenFile)
+		if err != nil {
+			printErrorAndExit(66, "Failed to read token file: %s", err)
 		}
+		client.SetToken(strings.TrimSpace(string(content)))
+	}
+
+	if *service == "" && *owner == "" {
+		services := client.GetServices([]string{})
+		printUsageErrorAndExit("-service or -owner is required, please specify one of the following services: " + strings.Join(services, " ,"))
+	}
+	client.SetOwner(*owner)
+	selected, missing := client.SelectServices()
+	if len(missing) > 0 {
+		services := client.GetServices([]string{})
+		printUsageErrorAndExit("-service %s not found, please specify one of the following services: %s", strings.Join(missing, ","), strings.Join(services, " ,"))
+	}
+	if len(selected) == 0 {
+		services := client.GetServices([]string{})
+		printUsageErrorAndExit("no service matches -service or -owner, please specify one of the following services: " + strings.Join(services, " ,"))
+	}
+	switch *color {
+	case "always":
+		client.SetColor(true)
+	case "never":
+		client.SetColor(false)
+	case "auto":
+		client.SetColor(isTerminal(os.Stdout))
+	default:
+		printUsageErrorAndExit("-color should be `auto`, `always` or `never`")
 	}
 
-	client.SetFilters(*pods, *clusters, *podid, *env, *rev)
+	client.SetFilters(*pods, *clusters, *podid, *env, *rev, *levels)
+	client.SetWhere(where)
+	client.SetQuery(*queryArg)
+	if *beforeContext == 0 {
+		*beforeContext = *contextLines
+	}
+	if *afterContext == 0 {
+		*afterContext = *contextLines
+	}
+	client.SetGrep(*grepArg, *grepInverted, *grepField, *ignoreCase, *beforeContext, *afterContext)
+	client.SetEvents(*isEvents)
 
 	fmt.Println("Starting client Subscribe")
 
@@ -79,7 +165,24 @@ func main() {
 		}
 		client.Subscribe2Elasticsearch()
 	} else {
-		client.Subscribe2CtailServers()
+		if *followFrom != "" {
+			if *isEvents {
+				client.SetHistoryParams(*elasticClusters, *eventsindices, *maxMessages, *followFrom)
+			} else {
+				client.SetHistoryParams(*elasticClusters, *indices, *maxMessages, *followFrom)
+			}
+			client.SubscribeFollow(*followOverlap)
+		} else {
+			client.Subscribe2CtailServers()
+		}
+		// Print the per server connections summary before exiting
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			client.PrintStatus()
+			os.Exit(0)
+		}()
 	}
 
 	// Consume and print logs/events
@@ -0,0 +1,22 @@
+package ctailclient
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// serviceColors are the ANSI colors of the service prefixes, dark and bright variants of the basic colors
+// that read well on both dark and light terminals.
+var serviceColors = []string{"31", "32", "33", "34", "35", "36", "91", "92", "93", "94", "95", "96"}
+
+// servicePrefix returns the prefix column of the messages of service padded to width, every service
+// keeps the same color across sessions as it is picked by a hash of its name.
+func (c *ctailclient) servicePrefix(service string, width int) string {
+	name := fmt.Sprintf("%-*s", width, service)
+	if !c.color {
+		return "[" + name + "] "
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(service))
+	return "[\x1b[" + serviceColors[hash.Sum32()%uint32(len(serviceColors))] + "m" + name + "\x1b[0m] "
+}
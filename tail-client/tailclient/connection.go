@@ -0,0 +1,330 @@
+package ctailclient
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sciffer/sse"
+)
+
+const (
+	// statusEvent is the event type of the connection markers interleaved with the messages
+	statusEvent = "ctail-status"
+	// gapEvent is sent by ctail servers after a resume when the replay buffer did not cover the whole gap
+	gapEvent = "ctail-gap"
+	// shutdownEvent is the last event sent by ctail servers that shut down gracefully
+	shutdownEvent = "ctail-shutdown"
+	// rebalanceEvent is sent by ctail servers after the kafka partitions moved between them
+	rebalanceEvent = "ctail-rebalance"
+	// droppedEvent is sent by ctail servers that dropped messages because the client could not keep up
+	droppedEvent = "ctail-dropped"
+
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// connection supervises the event stream of a single ctail server, it reconnects with exponential
+// backoff and resumes from the last seen event id when the server supports replay.
+type connection struct {
+	mu          sync.Mutex
+	endpoint    string
+	eventsURL   string
+	stream      string
+	replay      bool
+	websocket   bool
+	grpc        bool
+	token       string
+	httpClient  *http.Client
+	tlsConfig   *tls.Config // nil without TLS
+	connected   bool
+	lastEventID string
+	lastError   error
+	received    int64
+	missed      int64
+	reconnects  int
+	rebalanced  chan<- struct{}
+	stop        chan struct{}
+	cancel      context.CancelFunc
+}
+
+// newConnection creates a connection, eventsURL is a ws:// url for the WebSocket transport and grpc:// for gRPC.
+// Rebalance notifications of the server are signaled on rebalanced.
+func newConnection(endpoint string, eventsURL string, stream string, replay bool, rebalanced chan<- struct{}) *connection {
+	return &connection{
+		endpoint:   endpoint,
+		eventsURL:  eventsURL,
+		stream:     stream,
+		replay:     replay,
+		websocket:  strings.HasPrefix(eventsURL, "ws"),
+		grpc:       strings.HasPrefix(eventsURL, "grpc://"),
+		httpClient: http.DefaultClient,
+		rebalanced: rebalanced,
+		stop:       make(chan struct{}),
+	}
+}
+
+// close unsubscribes from the server, supervise returns without reconnecting
+func (conn *connection) close() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	select {
+	case <-conn.stop:
+		return
+	default:
+	}
+	close(conn.stop)
+	if conn.cancel != nil {
+		conn.cancel()
+	}
+}
+
+// supervise keeps the connection subscribed until it is closed, messages and status markers are sent to output
+func (conn *connection) supervise(output chan *streamEvent) {
+	backoff := minBackoff
+	for attempt := 0; ; attempt++ {
+		err := conn.consume(output, attempt > 0, func() { backoff = minBackoff })
+		select {
+		case <-conn.stop:
+			conn.mu.Lock()
+			conn.connected = false
+			conn.mu.Unlock()
+			return
+		default:
+		}
+
+		conn.mu.Lock()
+		wasConnected := conn.connected
+		conn.connected = false
+		conn.lastError = err
+		conn.mu.Unlock()
+		if wasConnected {
+			output <- statusMarker("[server %s disconnected: %s]", conn.endpoint, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-conn.stop:
+			return
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// begin returns the context of a subscription attempt, it is canceled when the connection is closed
+func (conn *connection) begin() (context.Context, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	select {
+	case <-conn.stop:
+		cancel()
+		return nil, nil, fmt.Errorf("connection closed")
+	default:
+	}
+	conn.cancel = cancel
+	return ctx, cancel, nil
+}
+
+// onConnected marks the connection as connected and tells about the events missed while reconnecting
+func (conn *connection) onConnected(output chan *streamEvent, reconnect bool, lastEventID string, onConnect func()) {
+	conn.mu.Lock()
+	conn.connected = true
+	if reconnect {
+		conn.reconnects++
+	}
+	conn.mu.Unlock()
+	onConnect()
+	if reconnect {
+		if conn.replay {
+			output <- statusMarker("[server %s reconnected, resuming from event %s]", conn.endpoint, lastEventID)
+		} else {
+			output <- statusMarker("[server %s reconnected, events published while disconnected were missed]", conn.endpoint)
+		}
+	}
+}
+
+// consume reads the event stream until it fails, onConnect is called once the server accepted the subscription
+func (conn *connection) consume(output chan *streamEvent, reconnect bool, onConnect func()) error {
+	if conn.websocket {
+		return conn.consumeWS(output, reconnect, onConnect)
+	}
+	if conn.grpc {
+		return conn.consumeGRPC(output, reconnect, onConnect)
+	}
+	req, err := http.NewRequest("GET", conn.eventsURL, nil)
+	if err != nil {
+		return err
+	}
+	ctx, cancel, err := conn.begin()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	req = req.WithContext(ctx)
+	query := req.URL.Query()
+	query.Set("stream", conn.stream)
+	req.URL.RawQuery = query.Encode()
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	if conn.token != "" {
+		req.Header.Set("Authorization", "Bearer "+conn.token)
+	}
+	conn.mu.Lock()
+	lastEventID := conn.lastEventID
+	conn.mu.Unlock()
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := conn.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	conn.onConnected(output, reconnect, lastEventID, onConnect)
+
+	reader := bufio.NewReader(resp.Body)
+	event := &sse.Event{}
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("stream closed by server")
+			}
+			return err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) == 0 {
+			if string(event.Event) == shutdownEvent {
+				return fmt.Errorf("server is shutting down")
+			}
+			if event.Data != nil {
+				conn.dispatch(event, output)
+			}
+			event = &sse.Event{}
+			continue
+		}
+		field, value := parseField(line)
+		switch field {
+		case "id":
+			event.ID = value
+		case "event":
+			event.Event = value
+		case "data":
+			if event.Data != nil {
+				event.Data = append(append(event.Data, '\n'), value...)
+			} else {
+				event.Data = value
+			}
+		}
+	}
+}
+
+// dispatch forwards a complete event, server control events are turned into status markers
+func (conn *connection) dispatch(event *sse.Event, output chan *streamEvent) {
+	if string(event.Event) == rebalanceEvent {
+		// a pending notification already covers this one
+		select {
+		case conn.rebalanced <- struct{}{}:
+		default:
+		}
+		output <- statusMarker("[server %s: partitions rebalanced, re-routing]", conn.endpoint)
+		return
+	}
+	if string(event.Event) == gapEvent {
+		gap := struct {
+			Missed int64 `json:"missed"`
+		}{}
+		json.Unmarshal(event.Data, &gap)
+		if gap.Missed < 0 {
+			output <- statusMarker("[server %s restarted, an unknown number of events was missed]", conn.endpoint)
+		} else {
+			conn.mu.Lock()
+			conn.missed += gap.Missed
+			conn.mu.Unlock()
+			output <- statusMarker("[server %s: %d events missed]", conn.endpoint, gap.Missed)
+		}
+		return
+	}
+	if string(event.Event) == droppedEvent {
+		dropped := struct {
+			Dropped int64 `json:"dropped"`
+		}{}
+		json.Unmarshal(event.Data, &dropped)
+		conn.mu.Lock()
+		conn.missed += dropped.Dropped
+		conn.mu.Unlock()
+		output <- statusMarker("[server %s: %d events dropped, the client is too slow]", conn.endpoint, dropped.Dropped)
+		return
+	}
+	conn.mu.Lock()
+	if len(event.ID) > 0 {
+		conn.lastEventID = string(event.ID)
+	}
+	conn.received++
+	conn.mu.Unlock()
+	output <- &streamEvent{Event: event, service: conn.stream}
+}
+
+// parseField splits an event stream line into its field name and value
+func parseField(line []byte) (string, []byte) {
+	colon := bytes.IndexByte(line, ':')
+	if colon == -1 {
+		return string(line), []byte{}
+	}
+	value := line[colon+1:]
+	if len(value) > 0 && value[0] == ' ' {
+		value = value[1:]
+	}
+	return string(line[:colon]), value
+}
+
+// status returns a one line summary of the connection state
+func (conn *connection) status() string {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	state := "connected"
+	if !conn.connected {
+		state = "disconnected"
+		if conn.lastError != nil {
+			state += " (" + conn.lastError.Error() + ")"
+		}
+	}
+	host := conn.endpoint
+	if parsed, err := url.Parse(conn.endpoint); err == nil && parsed.Host != "" {
+		host = parsed.Host
+	}
+	return fmt.Sprintf("%s\t%s\t%s\treceived=%d\tmissed=%d\treconnects=%d", host, conn.stream, state, conn.received, conn.missed, conn.reconnects)
+}
+
+// streamEvent is an event of service, the service is empty for status markers.
+type streamEvent struct {
+	*sse.Event
+	service string
+}
+
+// isStatus returns true for the status markers of the client
+func (e *streamEvent) isStatus() bool {
+	return string(e.Event.Event) == statusEvent
+}
+
+// statusMarker returns a status marker of the client, formatted as fmt.Sprintf
+func statusMarker(format string, values ...interface{}) *streamEvent {
+	return &streamEvent{Event: &sse.Event{Event: []byte(statusEvent), Data: []byte(fmt.Sprintf(format, values...))}}
+}
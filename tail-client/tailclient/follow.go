@@ -0,0 +1,113 @@
+package ctailclient
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"time"
+)
+
+const (
+	// followPageSize is the number of messages backfilled per elasticsearch query
+	followPageSize = 1000
+	// maxFollowPending bounds the live messages held back during the backfill, past it the live streams
+	// are not read until the backfill is done, so the servers report the messages they drop meanwhile
+	maxFollowPending = 10000
+)
+
+// SubscribeFollow backfills the history from elasticsearch and then switches to the live ctail servers.
+// Live messages are requested from overlap before now so the switch has no gap, and the messages that
+// show up in both the backfill and the live streams are dropped based on their timestamp, pod and message.
+// A backfill cut short by an elasticsearch error is reported with a status marker.
+func (c *ctailclient) SubscribeFollow(overlap time.Duration) {
+	output := c.messages
+	backfill := make(chan *streamEvent, c.bufferSize)
+	live := make(chan *streamEvent, c.bufferSize)
+
+	// Subscribe to live first, so nothing published while querying elasticsearch is lost
+	c.backfillUntil = time.Now()
+	c.since = c.backfillUntil.Add(-overlap)
+	c.messages = live
+	c.Subscribe2CtailServers()
+	c.messages = backfill
+	c.Subscribe2Elasticsearch()
+	c.messages = output
+
+	go mergeFollow(backfill, live, output, overlap)
+}
+
+// mergeFollow forwards the backfill until it is done while holding back up to maxFollowPending live messages,
+// then forwards the live messages skipping the ones already backfilled.
+func mergeFollow(backfill chan *streamEvent, live chan *streamEvent, output chan *streamEvent, overlap time.Duration) {
+	seen := map[uint64]struct{}{}
+	newest := time.Time{}
+	pending := []*streamEvent{}
+	for backfill != nil {
+		held := live
+		if len(pending) >= maxFollowPending {
+			held = nil // blocks until the backfill is done
+		}
+		select {
+		case msg, more := <-backfill:
+			if !more {
+				backfill = nil
+				break
+			}
+			if !msg.isStatus() {
+				key, ts := dedupKey(msg)
+				seen[key] = struct{}{}
+				if ts.After(newest) {
+					newest = ts
+				}
+			}
+			output <- msg
+		case msg := <-held:
+			pending = append(pending, msg)
+		}
+	}
+	output <- statusMarker("[backfill done, following live messages]")
+
+	forward := func(msg *streamEvent) {
+		if seen != nil && !msg.isStatus() {
+			key, ts := dedupKey(msg)
+			if _, duplicate := seen[key]; duplicate {
+				return
+			}
+			// Past the overlap window no backfilled message can show up live anymore
+			if ts.After(newest.Add(overlap)) {
+				seen = nil
+			}
+		}
+		output <- msg
+	}
+	for _, msg := range pending {
+		forward(msg)
+	}
+	for msg := range live {
+		forward(msg)
+	}
+}
+
+// dedupKey returns a hash of the message timestamp, pod and message text along with its parsed timestamp
+func dedupKey(msg *streamEvent) (uint64, time.Time) {
+	var jsonmsg struct {
+		Timestamp  string `json:"@timestamp"`
+		Host       string `json:"host"`
+		Message    string `json:"message"`
+		Kubernetes struct {
+			PodName string `json:"pod_name"`
+		} `json:"kubernetes"`
+	}
+	json.Unmarshal(msg.Data, &jsonmsg)
+	pod := jsonmsg.Kubernetes.PodName
+	if pod == "" {
+		pod = jsonmsg.Host
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(jsonmsg.Timestamp))
+	hash.Write([]byte{0})
+	hash.Write([]byte(pod))
+	hash.Write([]byte{0})
+	hash.Write([]byte(jsonmsg.Message))
+	ts, _ := time.Parse(time.RFC3339, jsonmsg.Timestamp)
+	return hash.Sum64(), ts
+}
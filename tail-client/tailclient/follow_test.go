@@ -0,0 +1,98 @@
+package ctailclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sciffer/sse"
+)
+
+// logEvent returns the event of a message of pod logged at second
+func logEvent(second int, pod string, message string) *streamEvent {
+	data := fmt.Sprintf(`{"@timestamp":"2024-01-02T10:00:%02dZ","kubernetes":{"pod_name":%q},"message":%q}`, second, pod, message)
+	return &streamEvent{Event: &sse.Event{Data: []byte(data)}, service: "svc"}
+}
+
+// describe returns the message of msg, or its text for status markers
+func describe(msg *streamEvent) string {
+	if msg.isStatus() {
+		return "[" + string(msg.Data) + "]"
+	}
+	var jsonmsg struct {
+		Message string `json:"message"`
+	}
+	json.Unmarshal(msg.Data, &jsonmsg)
+	return jsonmsg.Message
+}
+
+func TestMergeFollow(t *testing.T) {
+	backfill := make(chan *streamEvent)
+	live := make(chan *streamEvent, 10)
+	output := make(chan *streamEvent, 20)
+	done := make(chan struct{})
+	go func() {
+		mergeFollow(backfill, live, output, 5*time.Second)
+		close(done)
+	}()
+
+	// Live messages published while querying elasticsearch are held back until the backfill is done
+	live <- logEvent(9, "p1", "b")
+	live <- logEvent(10, "p1", "c")
+	backfill <- logEvent(8, "p1", "a")
+	backfill <- logEvent(9, "p1", "b")
+	backfill <- logEvent(9, "p2", "b")
+	close(backfill)
+	// Same timestamp and pod but another message isn't a duplicate
+	live <- logEvent(9, "p1", "b2")
+	live <- statusMarker("status")
+	// Past the overlap window dedup stops, the same message is printed again
+	live <- logEvent(15, "p1", "d")
+	live <- logEvent(8, "p1", "a")
+	close(live)
+	<-done
+	close(output)
+
+	got := []string{}
+	for msg := range output {
+		got = append(got, describe(msg))
+	}
+	want := "a b b [[backfill done, following live messages]] c b2 [status] d a"
+	if strings.Join(got, " ") != want {
+		t.Errorf("got %q, want %q", strings.Join(got, " "), want)
+	}
+}
+
+func TestMergeFollowBoundsPending(t *testing.T) {
+	backfill := make(chan *streamEvent)
+	live := make(chan *streamEvent, maxFollowPending+1)
+	output := make(chan *streamEvent, maxFollowPending+10)
+	for i := 0; i <= maxFollowPending; i++ {
+		live <- logEvent(30, "p1", fmt.Sprint(i))
+	}
+	go mergeFollow(backfill, live, output, time.Second)
+
+	deadline := time.Now().Add(time.Second)
+	for len(live) > 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if len(live) != 1 {
+		t.Fatalf("got %d unread live messages, want 1", len(live))
+	}
+	backfill <- statusMarker("cut short")
+	close(backfill)
+	close(live)
+
+	want := []string{"[cut short]", "[[backfill done, following live messages]]"}
+	for i := 0; i <= maxFollowPending; i++ {
+		want = append(want, fmt.Sprint(i))
+	}
+	for i, message := range want {
+		if got := describe(<-output); got != message {
+			t.Fatalf("message %d: got %q, want %q", i, got, message)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package ctailclient
+
+import (
+	"container/list"
+	"regexp"
+	"strings"
+
+	"github.com/sciffer/tail/tail-client/query"
+)
+
+// maxGrepPods bounds the number of pods whose context is tracked, the least recently seen pods are forgotten
+const maxGrepPods = 1024
+
+// highlightStart and highlightEnd surround the matches of -grep, the same bold red grep uses
+const (
+	highlightStart = "\x1b[01;31m"
+	highlightEnd   = "\x1b[0m"
+)
+
+// grep selects the messages whose field matches pattern and doesn't match inverted, along with up to
+// before/after context messages around every match. The context is tracked per pod(or host), so the
+// messages of other pods interleaved with the matches don't show up as their context.
+type grep struct {
+	pattern  *regexp.Regexp // nil matches all
+	inverted *regexp.Regexp // nil excludes none
+	path     []string
+	before   int
+	after    int
+	pods     map[string]*list.Element // of *grepContext, by pod
+	recent   *list.List               // the pods being tracked, the most recently seen first
+}
+
+// grepContext is the context state of a pod
+type grepContext struct {
+	pod      string
+	previous []greppedMessage // up to before of the latest messages that weren't printed
+	after    int              // the messages left to print after the last match
+	printed  bool             // whether any message of the pod was printed
+	skipped  bool             // whether messages were skipped since the last printed one
+}
+
+// greppedMessage is a message to print along with its service, a nil message is a context separator
+type greppedMessage struct {
+	jsonmsg map[string]interface{}
+	service string
+}
+
+// SetGrep prints only the messages whose field(a dotted json path) matches pattern and doesn't match inverted,
+// either may be empty. Matches are highlighted in the msg-only output when coloring, before and after are the
+// number of context messages of the same pod printed around every match.
+func (c *ctailclient) SetGrep(pattern string, inverted string, field string, ignoreCase bool, before int, after int) {
+	if pattern == "" && inverted == "" {
+		if before > 0 || after > 0 {
+			printUsageErrorAndExit("-A, -B and -C require -grep or -grep-v")
+		}
+		return
+	}
+	flags := ""
+	if ignoreCase {
+		flags = "(?i)"
+	}
+	g := &grep{path: strings.Split(field, "."), before: before, after: after, pods: make(map[string]*list.Element), recent: list.New()}
+	var err error
+	if pattern != "" {
+		if g.pattern, err = regexp.Compile(flags + pattern); err != nil {
+			printUsageErrorAndExit("invalid -grep: %s", err)
+		}
+	}
+	if inverted != "" {
+		if g.inverted, err = regexp.Compile(flags + inverted); err != nil {
+			printUsageErrorAndExit("invalid -grep-v: %s", err)
+		}
+	}
+	c.grep = g
+}
+
+// selected returns true if the field of jsonmsg matches the pattern and doesn't match the inverted pattern
+func (g *grep) selected(jsonmsg map[string]interface{}) bool {
+	text := strings.Join(query.Values(jsonmsg, g.path), "\n")
+	if g.pattern != nil && !g.pattern.MatchString(text) {
+		return false
+	}
+	return g.inverted == nil || !g.inverted.MatchString(text)
+}
+
+// feed returns the messages to print once jsonmsg of service was received: nothing, jsonmsg itself or
+// jsonmsg preceded by its context, with a separator between the non adjacent context groups of a pod.
+func (g *grep) feed(jsonmsg map[string]interface{}, service string) []greppedMessage {
+	pod := ""
+	if values := query.Values(jsonmsg, []string{"kubernetes", "pod_name"}); len(values) > 0 {
+		pod = values[0]
+	} else if values := query.Values(jsonmsg, []string{"host"}); len(values) > 0 {
+		pod = values[0]
+	}
+	ctx := g.context(pod)
+
+	msg := greppedMessage{jsonmsg: jsonmsg, service: service}
+	if !g.selected(jsonmsg) {
+		if ctx.after > 0 {
+			ctx.after--
+			ctx.printed = true
+			return []greppedMessage{msg}
+		}
+		if g.before > 0 {
+			if len(ctx.previous) == g.before {
+				ctx.previous = ctx.previous[1:]
+				ctx.skipped = true
+			}
+			ctx.previous = append(ctx.previous, msg)
+		} else {
+			ctx.skipped = true
+		}
+		return nil
+	}
+
+	lines := []greppedMessage{}
+	if ctx.printed && ctx.skipped && (g.before > 0 || g.after > 0) {
+		lines = append(lines, greppedMessage{service: service})
+	}
+	lines = append(append(lines, ctx.previous...), msg)
+	ctx.previous = nil
+	ctx.after = g.after
+	ctx.printed = true
+	ctx.skipped = false
+	return lines
+}
+
+// context returns the context state of pod, tracking it as the most recently seen pod
+func (g *grep) context(pod string) *grepContext {
+	if element, ok := g.pods[pod]; ok {
+		g.recent.MoveToFront(element)
+		return element.Value.(*grepContext)
+	}
+	ctx := &grepContext{pod: pod}
+	g.pods[pod] = g.recent.PushFront(ctx)
+	if g.recent.Len() > maxGrepPods {
+		oldest := g.recent.Back()
+		g.recent.Remove(oldest)
+		delete(g.pods, oldest.Value.(*grepContext).pod)
+	}
+	return ctx
+}
+
+// highlight surrounds the matches of the pattern in the field of jsonmsg, when it is a string
+func (g *grep) highlight(jsonmsg map[string]interface{}) {
+	if g.pattern == nil {
+		return
+	}
+	object := jsonmsg
+	for _, key := range g.path[:len(g.path)-1] {
+		next, ok := object[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		object = next
+	}
+	key := g.path[len(g.path)-1]
+	if text, ok := object[key].(string); ok {
+		object[key] = g.pattern.ReplaceAllStringFunc(text, func(match string) string {
+			return highlightStart + match + highlightEnd
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package ctailclient
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// newGrep returns the grep of -grep pattern and -grep-v inverted over the message field
+func newGrep(pattern string, inverted string, before int, after int) *grep {
+	c := &ctailclient{}
+	c.SetGrep(pattern, inverted, "message", false, before, after)
+	return c.grep
+}
+
+// feedAll feeds the "pod/message" messages to g and returns the printed messages, -- for the separators
+func feedAll(g *grep, messages ...string) string {
+	printed := []string{}
+	for _, message := range messages {
+		parts := strings.SplitN(message, "/", 2)
+		jsonmsg := map[string]interface{}{"kubernetes": map[string]interface{}{"pod_name": parts[0]}, "message": parts[1]}
+		for _, line := range g.feed(jsonmsg, "svc") {
+			if line.jsonmsg == nil {
+				printed = append(printed, "--")
+			} else {
+				printed = append(printed, line.jsonmsg["message"].(string))
+			}
+		}
+	}
+	return strings.Join(printed, " ")
+}
+
+func TestGrepFeed(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		inverted string
+		before   int
+		after    int
+		messages []string
+		want     string
+	}{
+		{
+			name:     "no context",
+			pattern:  "ERR",
+			messages: []string{"p/a", "p/ERR1", "p/b", "p/ERR2"},
+			want:     "ERR1 ERR2",
+		},
+		{
+			name:     "inverted",
+			inverted: "DEBUG",
+			messages: []string{"p/DEBUG a", "p/info", "p/DEBUG b"},
+			want:     "info",
+		},
+		{
+			name:     "pattern and inverted",
+			pattern:  "ERR",
+			inverted: "retry",
+			messages: []string{"p/ERR retry", "p/ERR fatal"},
+			want:     "ERR fatal",
+		},
+		{
+			name:     "before and after",
+			pattern:  "ERR",
+			before:   1,
+			after:    1,
+			messages: []string{"p/a", "p/b", "p/ERR1", "p/c", "p/d", "p/e", "p/ERR2", "p/f", "p/g"},
+			want:     "b ERR1 c -- e ERR2 f",
+		},
+		{
+			name:     "adjacent groups are joined",
+			pattern:  "ERR",
+			before:   1,
+			after:    1,
+			messages: []string{"p/ERR1", "p/a", "p/b", "p/ERR2"},
+			want:     "ERR1 a b ERR2",
+		},
+		{
+			name:     "after only",
+			pattern:  "ERR",
+			after:    2,
+			messages: []string{"p/ERR1", "p/a", "p/b", "p/c", "p/ERR2", "p/d"},
+			want:     "ERR1 a b -- ERR2 d",
+		},
+		{
+			name:     "context per pod",
+			pattern:  "ERR",
+			before:   1,
+			after:    1,
+			messages: []string{"p1/a", "p2/x", "p1/ERR1", "p2/y", "p1/b", "p2/ERR2"},
+			want:     "a ERR1 b y ERR2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := newGrep(test.pattern, test.inverted, test.before, test.after)
+			if got := feedAll(g, test.messages...); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGrepHighlight(t *testing.T) {
+	g := newGrep("ERR[0-9]", "", 0, 0)
+	jsonmsg := map[string]interface{}{"message": "ERR1 and ERR2", "level": "ERR3"}
+	g.highlight(jsonmsg)
+	if want := highlightStart + "ERR1" + highlightEnd + " and " + highlightStart + "ERR2" + highlightEnd; jsonmsg["message"] != want {
+		t.Errorf("got %q, want %q", jsonmsg["message"], want)
+	}
+	if jsonmsg["level"] != "ERR3" {
+		t.Errorf("got %q, want the other fields untouched", jsonmsg["level"])
+	}
+}
+
+func TestGrepForgetsLeastRecentPods(t *testing.T) {
+	g := newGrep("ERR", "", 1, 1)
+	// p0 has a pending before context and is seen again once all the other pods were seen
+	feedAll(g, "p0/a")
+	for i := 1; i < maxGrepPods; i++ {
+		feedAll(g, fmt.Sprintf("p%d/a", i))
+	}
+	feedAll(g, "p0/b")
+	feedAll(g, "new/a")
+	if len(g.pods) != maxGrepPods || g.recent.Len() != maxGrepPods {
+		t.Fatalf("got %d pods and %d recent, want %d", len(g.pods), g.recent.Len(), maxGrepPods)
+	}
+	if _, ok := g.pods["p1"]; ok {
+		t.Errorf("the least recently seen pod wasn't forgotten")
+	}
+	if got := feedAll(g, "p0/ERR"); got != "b ERR" {
+		t.Errorf("got %q, want the context of a recently seen pod kept", got)
+	}
+	if got := feedAll(g, "p1/ERR"); got != "ERR" {
+		t.Errorf("got %q, want a forgotten pod to start over", got)
+	}
+}
@@ -0,0 +1,116 @@
+package ctailclient
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/sciffer/sse"
+	"github.com/sciffer/tail/tail-client/tailgrpc"
+	"github.com/sciffer/tail/tailpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// grpcURL returns the grpc://<host>:<port> url of the gRPC API of endpoint with the query parameters
+func grpcURL(endpoint string, port string, query url.Values) string {
+	host := endpoint
+	if parsed, err := url.Parse(endpoint); err == nil && parsed.Host != "" {
+		host = parsed.Hostname()
+	}
+	grpcurl := "grpc://" + host + ":" + port
+	if len(query) > 0 {
+		grpcurl += "?" + query.Encode()
+	}
+	return grpcurl
+}
+
+// consumeGRPC reads the stream from the gRPC API until it fails, the events are dispatched as server-sent events
+// so the rest of the client handles all the transports the same way.
+func (conn *connection) consumeGRPC(output chan *streamEvent, reconnect bool, onConnect func()) error {
+	grpcurl, err := url.Parse(conn.eventsURL)
+	if err != nil {
+		return err
+	}
+	query := grpcurl.Query()
+	ctx, cancel, err := conn.begin()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	conn.mu.Lock()
+	since := conn.lastEventID
+	conn.mu.Unlock()
+	lastEventID := since
+	if since == "" {
+		since = query.Get("since")
+	}
+
+	options := []grpc.DialOption{ctailgrpc.WithToken(conn.token)}
+	if conn.tlsConfig != nil {
+		options = append(options, ctailgrpc.WithTLS(conn.tlsConfig))
+	}
+	client, err := ctailgrpc.Dial(grpcurl.Host, options...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	subscription, err := client.Subscribe(ctx, conn.stream, queryFilter(query), since)
+	if err != nil {
+		return grpcError(err)
+	}
+
+	conn.onConnected(output, reconnect, lastEventID, onConnect)
+
+	for {
+		event, err := subscription.Recv()
+		if err == io.EOF {
+			return fmt.Errorf("stream closed by server")
+		}
+		if err != nil {
+			return grpcError(err)
+		}
+		switch event.Type {
+		case tailpb.Event_GAP:
+			conn.dispatch(&sse.Event{Event: []byte(gapEvent), Data: []byte(fmt.Sprintf("{\"missed\":%d}", event.Missed))}, output)
+		case tailpb.Event_DROPPED:
+			conn.dispatch(&sse.Event{Event: []byte(droppedEvent), Data: []byte(fmt.Sprintf("{\"dropped\":%d}", event.Missed))}, output)
+		case tailpb.Event_REBALANCE:
+			conn.dispatch(&sse.Event{Event: []byte(rebalanceEvent), Data: event.Payload}, output)
+		default:
+			conn.dispatch(&sse.Event{ID: []byte(event.Id), Data: event.Payload}, output)
+		}
+	}
+}
+
+// queryFilter converts the /events filter query parameters into a gRPC filter
+func queryFilter(query url.Values) *tailpb.Filter {
+	split := func(param string) []string {
+		if value := query.Get(param); value != "" {
+			return strings.Split(value, ",")
+		}
+		return nil
+	}
+	filter := &tailpb.Filter{
+		Pods:     split("pod"),
+		PodIds:   split("podid"),
+		Envs:     split("env"),
+		Revs:     split("rev"),
+		Clusters: split("cluster"),
+		Levels:   split("level"),
+	}
+	for _, t := range split("type") {
+		if t == "event" {
+			filter.Types = append(filter.Types, tailpb.Event_EVENT)
+		} else {
+			filter.Types = append(filter.Types, tailpb.Event_LOG)
+		}
+	}
+	return filter
+}
+
+// grpcError strips the status code off err, so a shutdown reads the same as with the other transports
+func grpcError(err error) error {
+	return fmt.Errorf("%s", status.Convert(err).Message())
+}
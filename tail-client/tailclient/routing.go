@@ -0,0 +1,249 @@
+package ctailclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// routingInterval is how often the servers carrying the services are looked up again
+	routingInterval = time.Minute
+	// routingDelay lets all the members of the consumer group finish a rebalance before re-routing
+	routingDelay = 2 * time.Second
+)
+
+// routing is the partition routing reported by a ctail server: the kafka partitions per topic
+// assigned to it and the partitions per topic every service was seen on.
+type routing struct {
+	Assignment map[string][]int32            `json:"assignment"`
+	Services   map[string]map[string][]int32 `json:"services"`
+}
+
+// route is the subscription to the stream of a service on a ctail server
+type route struct {
+	endpoint string
+	service  string
+}
+
+// router holds the connections to the ctail servers carrying the services, by route.
+type router struct {
+	mu          sync.Mutex
+	connections map[route]*connection
+	rebalanced  chan struct{}
+}
+
+func newRouter() *router {
+	return &router{connections: make(map[route]*connection), rebalanced: make(chan struct{}, 1)}
+}
+
+func (r *router) add(rt route, conn *connection) {
+	r.mu.Lock()
+	r.connections[rt] = conn
+	r.mu.Unlock()
+}
+
+// remove closes and forgets the connection of rt
+func (r *router) remove(rt route) {
+	r.mu.Lock()
+	conn, ok := r.connections[rt]
+	delete(r.connections, rt)
+	r.mu.Unlock()
+	if ok {
+		conn.close()
+	}
+}
+
+func (r *router) connected(rt route) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.connections[rt]
+	return ok
+}
+
+// list returns the connections sorted by endpoint and service
+func (r *router) list() []*connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]*connection, 0, len(r.connections))
+	for _, conn := range r.connections {
+		list = append(list, conn)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].endpoint != list[j].endpoint {
+			return list[i].endpoint < list[j].endpoint
+		}
+		return list[i].stream < list[j].stream
+	})
+	return list
+}
+
+// GetRouting returns the partition routing of a ctail server, older servers don't support it and return nil
+func (c *ctailclient) GetRouting(endpoint string) (*routing, error) {
+	req, err := http.NewRequest("GET", endpoint+"/routing", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	r := &routing{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// routeTable is a snapshot of the routing of the ctail servers, to look up the servers carrying every service.
+type routeTable struct {
+	client   *ctailclient
+	answered map[string]bool     // the endpoints that could be asked
+	routes   map[string]*routing // by endpoint, for the servers supporting routing
+	listed   map[string][]string // the services listed by every endpoint, fetched on demand
+}
+
+// routeTable asks all the ctail servers for their routing
+func (c *ctailclient) routeTable() *routeTable {
+	t := &routeTable{client: c, answered: make(map[string]bool), routes: make(map[string]*routing), listed: make(map[string][]string)}
+	for _, endpoint := range c.urllist {
+		r, err := c.GetRouting(endpoint)
+		if err != nil {
+			continue
+		}
+		t.answered[endpoint] = true
+		if r != nil {
+			t.routes[endpoint] = r
+		}
+	}
+	return t
+}
+
+// carriers returns the endpoints carrying service, the partitions the service was seen on are collected from
+// all the servers, since after a rebalance the server now assigned a partition may not have consumed any message
+// of the service from it yet. Servers that don't support routing, or services that were never consumed from kafka,
+// fall back to /services. partitioned is true when the endpoints were picked by partitions.
+func (t *routeTable) carriers(service string) (carrying map[string]bool, partitioned bool) {
+	carrying = make(map[string]bool)
+	servicePartitions := make(map[string]map[int32]bool)
+	for _, r := range t.routes {
+		for topic, partitions := range r.Services[service] {
+			if servicePartitions[topic] == nil {
+				servicePartitions[topic] = make(map[int32]bool)
+			}
+			for _, partition := range partitions {
+				servicePartitions[topic][partition] = true
+			}
+		}
+	}
+
+	partitioned = len(servicePartitions) > 0
+	for endpoint := range t.answered {
+		r, ok := t.routes[endpoint]
+		if !partitioned || !ok {
+			carrying[endpoint] = includes(t.services(endpoint), service)
+			continue
+		}
+		for topic, partitions := range r.Assignment {
+			for _, partition := range partitions {
+				if servicePartitions[topic][partition] {
+					carrying[endpoint] = true
+				}
+			}
+		}
+	}
+	return carrying, partitioned
+}
+
+// services returns the services listed by endpoint, they are only asked for once
+func (t *routeTable) services(endpoint string) []string {
+	services, ok := t.listed[endpoint]
+	if !ok {
+		services = t.client.GetServices([]string{endpoint})
+		t.listed[endpoint] = services
+	}
+	return services
+}
+
+// connect subscribes to the stream of service on endpoint, the messages are sent to messages
+func (c *ctailclient) connect(endpoint string, service string, messages chan *streamEvent, since time.Time) {
+	eventsURL := endpoint + c.uri
+	capabilities := c.GetCapabilities(endpoint)
+	query := url.Values{}
+	// Let the server drop non matching messages, they are still filtered locally for servers that don't
+	if includes(capabilities, "filter") {
+		query = c.filterParams()
+	}
+	if !since.IsZero() && includes(capabilities, "replay") {
+		query.Set("since", since.UTC().Format(time.RFC3339))
+	}
+	if c.transport == "ws" && includes(capabilities, "ws") {
+		eventsURL = wsURL(endpoint, query)
+	} else if c.transport == "grpc" && includes(capabilities, "grpc") {
+		eventsURL = grpcURL(endpoint, c.grpcPort, query)
+	} else {
+		if c.transport != "sse" {
+			c.logger.Printf("Server %s doesn't support %s, falling back to SSE", endpoint, c.transport)
+		}
+		if len(query) > 0 {
+			eventsURL += "?" + query.Encode()
+		}
+	}
+	conn := newConnection(endpoint, eventsURL, service, includes(capabilities, "replay"), c.router.rebalanced)
+	conn.token = c.token
+	conn.httpClient = c.httpClient
+	if parsed, err := url.Parse(endpoint); err == nil {
+		conn.tlsConfig = c.tlsFor(parsed.Host)
+	}
+	c.router.add(route{endpoint: endpoint, service: service}, conn)
+	go conn.supervise(messages)
+}
+
+// reroute looks up the servers carrying the services periodically and after every rebalance,
+// subscribes to the servers that started carrying one and unsubscribes from the ones that stopped.
+// Services matching the -service patterns or -owner that showed up since are subscribed to as well.
+func (c *ctailclient) reroute(messages chan *streamEvent) {
+	ticker := time.NewTicker(routingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, service := range c.selectNew() {
+				messages <- statusMarker("[service %s matched, subscribing]", service)
+			}
+		case <-c.router.rebalanced:
+			time.Sleep(routingDelay)
+		}
+		table := c.routeTable()
+		for _, service := range c.services {
+			carrying, partitioned := table.carriers(service)
+			for _, endpoint := range c.urllist {
+				if !table.answered[endpoint] {
+					continue // unreachable servers keep reconnecting as they are
+				}
+				rt := route{endpoint: endpoint, service: service}
+				connected := c.router.connected(rt)
+				if carrying[endpoint] && !connected {
+					messages <- statusMarker("[server %s now carries %s, subscribing]", endpoint, service)
+					c.connect(endpoint, service, messages, time.Time{})
+				} else if !carrying[endpoint] && connected && partitioned {
+					// only the partitions tell for sure a server stopped carrying the service
+					messages <- statusMarker("[server %s no longer carries %s, unsubscribing]", endpoint, service)
+					c.router.remove(rt)
+				}
+			}
+		}
+	}
+}
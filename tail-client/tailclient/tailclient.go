@@ -1,6 +1,7 @@
 package ctailclient
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -8,12 +9,15 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"strings"
 	"text/template"
 	"time"
 	"github.com/sciffer/tail/tail-client/domain"
 	"github.com/sciffer/tail/tail-client/elasticsearch"
+	"github.com/sciffer/tail/tail-client/query"
 	ctemplate "github.com/sciffer/tail/tail-client/template"
 	"github.com/hokaccha/go-prettyjson"
 	"github.com/sciffer/sse"
@@ -23,13 +27,22 @@ type ctailclient struct {
 	tmpl                                                       *template.Template
 	logger                                                     log.Logger
 	podsfilter, clustersfilter, esclusters, esindices, urllist []string
+	levelfilter                                                []string
+	filter, esquery                                            query.And
+	grep                                                       *grep
 	esfilters                                                  map[string]interface{}
-	service, env, podid, rev, uri, timeOffset                  string
+	patterns, services                                         []string
+	owner, env, podid, rev, uri, timeOffset                    string
+	servers, transport, grpcPort, token                        string
+	serverNames                                                map[string]string
+	tlsConfig                                                  *tls.Config
+	httpClient                                                 *http.Client
 	location                                                   *time.Location
-	history                                                    bool
+	history, follow, events, prefixed, color                   bool
+	since, backfillUntil                                       time.Time
 	bufferSize, maxMessages                                    int
-	messages                                                   chan *sse.Event
-	clients                                                    []*sse.Client
+	messages                                                   chan *streamEvent
+	router                                                     *router
 	done                                                       chan bool
 }
 
@@ -38,11 +51,17 @@ func NewCtailClient(servers string, uri string, service string, fieldsArg string
 	client := ctailclient{}
 	client.esfilters = make(map[string]interface{})
 	client.logger = *log.New(os.Stderr, "", log.LstdFlags)
-	client.service = service
+	for _, pattern := range strings.Split(service, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			client.patterns = append(client.patterns, pattern)
+		}
+	}
 	client.uri = uri
 	client.history = history
 	client.bufferSize = bufferSize
-	client.urllist = getUrls(servers)
+	client.servers = servers
+	client.urllist, client.serverNames = getUrls(servers, "http")
+	client.httpClient = http.DefaultClient
 
 	tmpl, err := ctemplate.CreateTemplate(strings.Split(fieldsArg, ","))
 	if err != nil {
@@ -60,35 +79,234 @@ func NewCtailClient(servers string, uri string, service string, fieldsArg string
 	domain.Location = location
 
 	// ctailclient parallelism channels
-	client.messages = make(chan *sse.Event, client.bufferSize) // The channel will be used by all clients as a destination to events.
-	client.clients = []*sse.Client{}                           //slice of the sse clients, client per endpoint
+	client.messages = make(chan *streamEvent, client.bufferSize) // The channel will be used by all clients as a destination to events.
+	client.router = newRouter()                                  // the supervised server connections, connection per endpoint and service
 
 	return client
 }
 
+// SetOwner adds the services owned by owner to the services to tail
+func (c *ctailclient) SetOwner(owner string) {
+	c.owner = owner
+}
+
+// SetColor colors the service prefix of the messages when tailing several services, and the -grep matches
+func (c *ctailclient) SetColor(color bool) {
+	c.color = color
+}
+
+// SelectServices resolves the -service names and glob patterns and the -owner into the services to tail,
+// it returns the selected services and the names that matched no service. The messages are prefixed with
+// their service whenever more than one service may show up.
+func (c *ctailclient) SelectServices() (selected []string, missing []string) {
+	details := c.GetServiceDetails([]string{})
+	for _, pattern := range c.patterns {
+		if !isGlob(pattern) && !serviceIncluded(details, pattern) {
+			missing = append(missing, pattern)
+		}
+	}
+	c.services = c.matching(details)
+	c.prefixed = len(c.services) > 1 || c.dynamic()
+	return c.services, missing
+}
+
+// selectNew adds the services that started matching the glob patterns or the owner since they were selected,
+// it returns the added services.
+func (c *ctailclient) selectNew() []string {
+	if !c.dynamic() {
+		return nil
+	}
+	added := []string{}
+	for _, service := range c.matching(c.GetServiceDetails([]string{})) {
+		if !includes(c.services, service) {
+			c.services = append(c.services, service)
+			added = append(added, service)
+		}
+	}
+	return added
+}
+
+// matching returns the names of the services matching one of the patterns or owned by the owner
+func (c *ctailclient) matching(details []serviceDetails) []string {
+	matched := []string{}
+	for _, service := range details {
+		if c.owner != "" && service.Owner == c.owner {
+			matched = append(matched, service.Name)
+			continue
+		}
+		for _, pattern := range c.patterns {
+			if ok, _ := path.Match(pattern, service.Name); ok {
+				matched = append(matched, service.Name)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// dynamic returns true if the selected services may change over time, that is with glob patterns or an owner
+func (c *ctailclient) dynamic() bool {
+	if c.owner != "" {
+		return true
+	}
+	for _, pattern := range c.patterns {
+		if isGlob(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
 // SetFilters sets ctailclient filter attributes
-func (c *ctailclient) SetFilters(pods string, clusters string, podid string, env string, rev string) {
+func (c *ctailclient) SetFilters(pods string, clusters string, podid string, env string, rev string, levels string) {
 	// basic filters
 	c.env = env
 	c.podid = podid
 	c.rev = rev
 	// build pod filters
 	if pods != "" {
-		if c.history {
+		if c.history || c.follow {
 			c.esfilters["kubernetes.pod_name.keyword"] = strings.Split(pods, ",")
-		} else {
+		}
+		if !c.history {
 			c.podsfilter = strings.Split(pods, ",")
 		}
 	}
 
 	// build cluster filters
 	if clusters != "" {
-		if c.history {
+		if c.history || c.follow {
 			c.esfilters["kubernetes.labels.kubeCluster.keyword"] = strings.Split(clusters, ",")
-		} else {
+		}
+		if !c.history {
 			c.clustersfilter = strings.Split(clusters, ",")
 		}
 	}
+
+	// build level filters
+	if levels != "" {
+		if c.history || c.follow {
+			c.esfilters["level.keyword"] = strings.Split(levels, ",")
+		}
+		if !c.history {
+			c.levelfilter = strings.Split(levels, ",")
+		}
+	}
+
+	// the live messages are filtered locally as well, for servers that don't filter on their side
+	if !c.history {
+		c.addCondition("kubernetes.pod_name", c.podsfilter...)
+		c.addCondition("kubernetes.labels.kubeCluster", c.clustersfilter...)
+		c.addCondition("level", c.levelfilter...)
+		c.addCondition("kubernetes.labels.environment", env)
+		c.addCondition("kubernetes.labels.version", rev)
+		c.addCondition("kubernetes.pod_id", podid)
+	}
+}
+
+// addCondition filters the live messages on field being one of values, empty values are ignored
+func (c *ctailclient) addCondition(field string, values ...string) {
+	cond := whereCondition{field: field, path: strings.Split(field, "."), op: whereIn}
+	for _, value := range values {
+		if value != "" {
+			cond.values = append(cond.values, value)
+		}
+	}
+	if len(cond.values) > 0 {
+		c.filter = append(c.filter, cond)
+	}
+}
+
+// SetWhere sets the -where conditions, they filter the live messages and are added to the elasticsearch queries
+func (c *ctailclient) SetWhere(conditions []string) {
+	for _, expr := range conditions {
+		cond, err := parseWhere(expr)
+		if err != nil {
+			printUsageErrorAndExit("invalid -where %q: %s", expr, err)
+		}
+		c.esquery = append(c.esquery, cond)
+		if !c.history {
+			c.filter = append(c.filter, cond)
+		}
+	}
+}
+
+// SetQuery sets the -query, like: level:(ERROR OR WARN) AND NOT message:"health check" - it filters the live
+// messages and is added to the elasticsearch queries
+func (c *ctailclient) SetQuery(expr string) {
+	if expr == "" {
+		return
+	}
+	node, err := query.Parse(expr)
+	if err != nil {
+		printUsageErrorAndExit("invalid -query: %s", err)
+	}
+	c.esquery = append(c.esquery, node)
+	if !c.history {
+		c.filter = append(c.filter, node)
+	}
+}
+
+// filterParams returns the live filters as /events query parameters, for servers that filter on their side
+func (c *ctailclient) filterParams() url.Values {
+	query := url.Values{}
+	if len(c.podsfilter) > 0 {
+		query.Set("pod", strings.Join(c.podsfilter, ","))
+	}
+	if len(c.clustersfilter) > 0 {
+		query.Set("cluster", strings.Join(c.clustersfilter, ","))
+	}
+	if len(c.levelfilter) > 0 {
+		query.Set("level", strings.Join(c.levelfilter, ","))
+	}
+	if len(c.env) > 0 {
+		query.Set("env", c.env)
+	}
+	if len(c.rev) > 0 {
+		query.Set("rev", c.rev)
+	}
+	if len(c.podid) > 0 {
+		query.Set("podid", c.podid)
+	}
+	// only the requested type is sent, so events don't come along with all the logs
+	if c.events {
+		query.Set("type", "event")
+	} else {
+		query.Set("type", "log")
+	}
+	return query
+}
+
+// SetEvents tails the events of the service instead of its logs
+func (c *ctailclient) SetEvents(events bool) {
+	c.events = events
+}
+
+// SetFollow enables follow mode, history is backfilled from elasticsearch before switching to the live servers
+func (c *ctailclient) SetFollow(follow bool) {
+	c.follow = follow
+}
+
+// SetTransport sets the transport of the live streams: sse, ws(WebSocket) or grpc on grpcPort of the servers
+func (c *ctailclient) SetTransport(transport string, grpcPort string) {
+	c.transport = transport
+	c.grpcPort = grpcPort
+}
+
+// SetToken sets the bearer token sent to the ctail servers that require authentication
+func (c *ctailclient) SetToken(token string) {
+	c.token = token
+}
+
+// authorize adds the bearer token to a ctail server request
+func (c *ctailclient) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
 }
 
 // SetHistoryParams sets ctailclient history parameters
@@ -96,15 +314,21 @@ func (c *ctailclient) SetHistoryParams(elasticClusters string, indices string, m
 	c.esclusters = strings.Split(elasticClusters, ",")
 	if len(c.env) > 0 {
 		c.esfilters["kubernetes.labels.environment.keyword"] = c.env
-		c.env = ""
+		if c.history {
+			c.env = ""
+		}
 	}
 	if len(c.rev) > 0 {
 		c.esfilters["kubernetes.labels.version.keyword"] = c.rev
-		c.rev = ""
+		if c.history {
+			c.rev = ""
+		}
 	}
 	if len(c.podid) > 0 {
 		c.esfilters["kubernetes.pod_id.keyword"] = c.podid
-		c.podid = ""
+		if c.history {
+			c.podid = ""
+		}
 	}
 	c.esindices = strings.Split(indices, ",")
 	c.timeOffset = timeOffset
@@ -116,12 +340,31 @@ func (c *ctailclient) SetHistoryParams(elasticClusters string, indices string, m
 
 func (c *ctailclient) Subscribe2Elasticsearch() {
 	c.logger.Print("Initializing clients:")
+	messages := c.messages
+	// the services are captured, following may select more of them for the live servers meanwhile
+	services := c.services
 	// Issue parallel elasticsearch queries against all clusters
 	for _, escluster := range c.esclusters {
-		client := elasticsearch.NewElasticsearch(escluster, c.esindices, c.service, c.timeOffset)
+		client := elasticsearch.NewElasticsearch(escluster, c.esindices, services, c.timeOffset)
+		if len(c.esquery) > 0 {
+			client.Filter(c.esquery.Query())
+		}
 		subscribeReport := func() {
-			if err := client.Query2sse(c.messages, c.esfilters, c.maxMessages); err != nil {
-				fmt.Println(err)
+			results := make(chan *sse.Event, c.bufferSize)
+			var err error
+			go func() {
+				if c.follow {
+					err = client.Backfill2sse(results, c.esfilters, c.backfillUntil, followPageSize)
+				} else if err = client.Query2sse(results, c.esfilters, c.maxMessages); err != nil {
+					fmt.Println(err)
+				}
+				close(results)
+			}()
+			for result := range results {
+				messages <- &streamEvent{Event: result, service: historyService(services, result.Data)}
+			}
+			if c.follow && err != nil {
+				messages <- statusMarker("[backfill from %s cut short, messages up to the live ones were missed: %s]", escluster, err)
 			}
 			c.done <- true
 		}
@@ -134,40 +377,57 @@ func (c *ctailclient) Subscribe2Elasticsearch() {
 		for counter < len(c.esclusters) && <-c.done {
 			counter++
 		}
-		close(c.messages)
+		close(messages)
 	}()
 	c.logger.Println("Done")
 }
 
+// historyService returns the service of a message queried from elasticsearch for services, found in its app field
+func historyService(services []string, data []byte) string {
+	if len(services) == 1 {
+		return services[0]
+	}
+	var jsonmsg struct {
+		App string `json:"app"`
+	}
+	json.Unmarshal(data, &jsonmsg)
+	return jsonmsg.App
+}
+
+// Subscribe2CtailServers subscribes to the ctail servers carrying the services, and keeps following
+// the services as their partitions move between servers
 func (c *ctailclient) Subscribe2CtailServers() {
 	c.logger.Print("Initializing clients:")
-	for _, url := range c.urllist {
-		serverservices := c.GetServices([]string{url})
-		if includes(serverservices, c.service) {
-			client := sse.NewClient(url + c.uri)
-			subscribeReport := func() {
-				if err := client.SubscribeChan(c.service, c.messages); err != nil {
-					c.logger.Println(err)
-				}
+	table := c.routeTable()
+	for _, service := range c.services {
+		carrying, _ := table.carriers(service)
+		for _, endpoint := range c.urllist {
+			if carrying[endpoint] {
+				c.connect(endpoint, service, c.messages, c.since)
+				//fmt.Print(".")
 			}
-			go subscribeReport()
-			c.clients = append(c.clients, client)
-			//fmt.Print(".")
 		}
 	}
+	go c.reroute(c.messages)
 	c.logger.Println("Done")
 }
 
 // ConsumeAndPrint consumes the logs/events and prints the output
 func (c *ctailclient) ConsumeAndPrint(isEvents bool, pretty bool, msgOnly bool) {
-	if len(c.clients) > 0 || c.history {
+	if len(c.router.list()) > 0 || c.history || c.follow {
 		c.logger.Println("Waiting for log messages to arrive:")
+		width := 0
 		for msg := range c.messages {
+			// Connection markers are printed as is
+			if msg.isStatus() {
+				fmt.Printf("%s\n", msg.Data)
+				continue
+			}
 			var jsonmsg map[string]interface{}
 			json.Unmarshal(msg.Data, &jsonmsg)
 
 			// Filter out nil and filters based on parameters
-			if jsonmsg == nil || (!c.history && isEvents != IsEvent(&jsonmsg)) || !c.filterEvent(&jsonmsg) {
+			if jsonmsg == nil || (!c.history && isEvents != IsEvent(&jsonmsg)) || !c.filter.Match(jsonmsg) {
 				continue
 			}
 
@@ -180,10 +440,31 @@ func (c *ctailclient) ConsumeAndPrint(isEvents bool, pretty bool, msgOnly bool)
 				jsonmsg["@timestamp"] = time.Now().In(c.location)
 			}
 
-			if pretty {
-				prettyMessagePrint(jsonmsg, msgOnly, isEvents)
-			} else {
-				messagePrint(jsonmsg, msgOnly, isEvents, c.tmpl)
+			lines := []greppedMessage{{jsonmsg: jsonmsg, service: msg.service}}
+			if c.grep != nil {
+				lines = c.grep.feed(jsonmsg, msg.service)
+			}
+			for _, line := range lines {
+				if line.jsonmsg == nil {
+					fmt.Println("--")
+					continue
+				}
+				if c.prefixed {
+					// the prefix column grows to the longest service seen so far
+					if len(line.service) > width {
+						width = len(line.service)
+					}
+					fmt.Print(c.servicePrefix(line.service, width))
+				}
+				if pretty {
+					prettyMessagePrint(line.jsonmsg, msgOnly, isEvents)
+				} else {
+					// the escape codes only make sense in the template output
+					if c.grep != nil && c.color && msgOnly {
+						c.grep.highlight(line.jsonmsg)
+					}
+					messagePrint(line.jsonmsg, msgOnly, isEvents, c.tmpl)
+				}
 			}
 		}
 		c.logger.Println("Closing client subscriptions...")
@@ -192,85 +473,22 @@ func (c *ctailclient) ConsumeAndPrint(isEvents bool, pretty bool, msgOnly bool)
 	}
 }
 
-// FilterEvent returns true if event matches provided filters
-func (c *ctailclient) filterEvent(jsonmsg *map[string]interface{}) bool {
-	// Filter of pod_name
-	if len(c.podsfilter) > 0 {
-		matched := false
-		if _, isKube := (*jsonmsg)["kubernetes"]; isKube {
-			if val, isPodName := ((*jsonmsg)["kubernetes"].(map[string]interface{}))["pod_name"]; isPodName {
-				if includes(c.podsfilter, val.(string)) {
-					matched = true
-				}
-			}
-		}
-		if !matched {
-			return false
-		}
-	}
-	// Filter of Environment
-	if len(c.env) > 0 {
-		matched := false
-		if _, isKube := (*jsonmsg)["kubernetes"]; isKube {
-			if _, isLabels := ((*jsonmsg)["kubernetes"].(map[string]interface{}))["labels"]; isLabels {
-				if val, isEnvironment := (((*jsonmsg)["kubernetes"].(map[string]interface{}))["labels"].(map[string]interface{}))["environment"].(string); isEnvironment && c.env == val {
-					matched = true
-				}
-			}
-		}
-		if !matched {
-			return false
-		}
-	}
-	// Filter of Revision/Version
-	if len(c.rev) > 0 {
-		matched := false
-		if _, isKube := (*jsonmsg)["kubernetes"]; isKube {
-			if _, isLabels := ((*jsonmsg)["kubernetes"].(map[string]interface{}))["labels"]; isLabels {
-				if val, isVersion := (((*jsonmsg)["kubernetes"].(map[string]interface{}))["labels"].(map[string]interface{}))["version"].(string); isVersion && c.rev == val {
-					matched = true
-				}
-			}
-		}
-		if !matched {
-			return false
-		}
-	}
-	// Filter of Pod_ID
-	if len(c.podid) > 0 {
-		matched := false
-		if _, isKube := (*jsonmsg)["kubernetes"]; isKube {
-			if val, isPodID := ((*jsonmsg)["kubernetes"].(map[string]interface{}))["pod_id"].(string); isPodID && c.podid == val {
-				matched = true
-			}
-		}
-		if !matched {
-			return false
-		}
+// PrintStatus prints a per server summary of the live connections
+func (c *ctailclient) PrintStatus() {
+	connections := c.router.list()
+	if len(connections) == 0 {
+		return
 	}
-	// Filter of KubeCluster
-	if len(c.clustersfilter) > 0 {
-		matched := false
-		if _, isKube := (*jsonmsg)["kubernetes"]; isKube {
-			if _, isLabels := ((*jsonmsg)["kubernetes"].(map[string]interface{}))["labels"]; isLabels {
-				if val, isKubeCluster := (((*jsonmsg)["kubernetes"].(map[string]interface{}))["labels"].(map[string]interface{}))["kubeCluster"].(string); isKubeCluster {
-					if includes(c.clustersfilter, val) {
-						matched = true
-					}
-				}
-			}
-		}
-		if !matched {
-			return false
-		}
+	fmt.Fprintln(os.Stderr, "Server connections status:")
+	for _, conn := range connections {
+		fmt.Fprintln(os.Stderr, conn.status())
 	}
-	return true
 }
 
-// IsEvent returns true if message is Event
+// IsEvent returns true if message is Event, that is its tags include EVENT
 func IsEvent(jsonmsg *map[string]interface{}) bool {
-	if tags, ok := (*jsonmsg)["tags"]; ok {
-		return strInterfaceIncluded(tags.([]interface{}), "EVENT")
+	if tags, ok := (*jsonmsg)["tags"].([]interface{}); ok {
+		return strInterfaceIncluded(tags, "EVENT")
 	}
 	return false
 }
@@ -278,7 +496,7 @@ func IsEvent(jsonmsg *map[string]interface{}) bool {
 // strInterfaceIncluded returns true if string interface included in string list/slice
 func strInterfaceIncluded(values []interface{}, value2match string) bool {
 	for _, val := range values {
-		if val.(string) == value2match {
+		if str, ok := val.(string); ok && str == value2match {
 			return true
 		}
 	}
@@ -291,15 +509,18 @@ func (c *ctailclient) GetServices(urls []string) []string {
 		urls = c.urllist
 	}
 	services := []string{}
-	DefaultClient := http.Client{}
 
 	c.logger.Printf("Connecting to: %s\n", strings.Join(urls, ","))
 	for _, url := range urls {
 		req, _ := http.NewRequest("GET", url+"/services", nil)
 		req.Header.Set("content-type", "application/json")
-		resp, err := DefaultClient.Do(req)
+		c.authorize(req)
+		resp, err := c.httpClient.Do(req)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Failed to connect to: %s/services\n", url)
+		} else if resp.StatusCode == http.StatusUnauthorized {
+			fmt.Fprintf(os.Stderr, "Not authenticated by: %s/services, use -token or -token-file\n", url)
+			resp.Body.Close()
 		} else {
 			body, err := ioutil.ReadAll(resp.Body)
 			if err == nil {
@@ -314,6 +535,85 @@ func (c *ctailclient) GetServices(urls []string) []string {
 	return servicelist
 }
 
+// serviceDetails is the metadata of a service listed by /services?details=true
+type serviceDetails struct {
+	Name  string `json:"name"`
+	Owner string `json:"owner"`
+}
+
+// GetServiceDetails returns the services available from ctailservers along with their owner, the owner is
+// unknown for older servers that only list the service names.
+func (c *ctailclient) GetServiceDetails(urls []string) []serviceDetails {
+	if len(urls) == 0 {
+		urls = c.urllist
+	}
+	services := []serviceDetails{}
+	for _, url := range urls {
+		req, _ := http.NewRequest("GET", url+"/services?details=true", nil)
+		req.Header.Set("content-type", "application/json")
+		c.authorize(req)
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to connect to: %s/services\n", url)
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			fmt.Fprintf(os.Stderr, "Not authenticated by: %s/services, use -token or -token-file\n", url)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		details := []serviceDetails{}
+		if json.Unmarshal(body, &details) != nil {
+			names := []string{}
+			json.Unmarshal(body, &names)
+			for _, name := range names {
+				details = append(details, serviceDetails{Name: name})
+			}
+		}
+		for _, service := range details {
+			if !serviceIncluded(services, service.Name) {
+				services = append(services, service)
+			} else if service.Owner != "" {
+				for i := range services {
+					if services[i].Name == service.Name && services[i].Owner == "" {
+						services[i].Owner = service.Owner
+					}
+				}
+			}
+		}
+	}
+	return services
+}
+
+func serviceIncluded(services []serviceDetails, name string) bool {
+	for _, service := range services {
+		if service.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GetCapabilities returns the optional features supported by a ctailserver, older servers support none
+func (c *ctailclient) GetCapabilities(endpoint string) []string {
+	capabilities := []string{}
+	resp, err := c.httpClient.Get(endpoint + "/capabilities")
+	if err != nil {
+		return capabilities
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if body, err := ioutil.ReadAll(resp.Body); err == nil {
+			json.Unmarshal(body, &capabilities)
+		}
+	}
+	return capabilities
+}
+
 func removeDuplicates(a []string) []string {
 	result := []string{}
 	seen := map[string]byte{}
@@ -335,8 +635,11 @@ func includes(arr []string, elem string) bool {
 	return false
 }
 
-func getUrls(servers string) []string {
+// getUrls resolves the servers into the urls of all their addresses, along with the host name of every address
+// which TLS certificates are verified against
+func getUrls(servers string, scheme string) ([]string, map[string]string) {
 	serverlist := []string{}
+	serverNames := make(map[string]string)
 	// Split to endpoints
 	for _, host := range strings.Split(servers, ",") {
 		// Split to host port pairs
@@ -347,11 +650,12 @@ func getUrls(servers string) []string {
 		addrs, err := net.LookupHost(pair[0])
 		if err == nil {
 			for _, addr := range addrs {
-				serverlist = append(serverlist, "http://"+addr+":"+pair[1])
+				serverlist = append(serverlist, scheme+"://"+addr+":"+pair[1])
+				serverNames[addr+":"+pair[1]] = pair[0]
 			}
 		}
 	}
-	return serverlist
+	return serverlist, serverNames
 }
 
 func prettyMessagePrint(jsonmsg map[string]interface{}, msgOnly bool, isEvents bool) {
@@ -0,0 +1,64 @@
+package ctailclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+)
+
+// SetTLS connects to the ctail servers over TLS(https, wss and gRPC over TLS), servers are verified with the CAs
+// of caFile(the system CAs when empty) and the certFile/keyFile client certificate is presented when provided.
+func (c *ctailclient) SetTLS(caFile string, certFile string, keyFile string) {
+	if (certFile == "") != (keyFile == "") {
+		printUsageErrorAndExit("-cert and -key should be used together")
+	}
+	config, err := loadTLSConfig(caFile, certFile, keyFile)
+	if err != nil {
+		printErrorAndExit(78, "Failed to load TLS configuration: %s", err)
+	}
+	c.tlsConfig = config
+	c.urllist, c.serverNames = getUrls(c.servers, "https")
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialTLSContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		dialer := &tls.Dialer{Config: c.tlsFor(addr)}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	c.httpClient = &http.Client{Transport: transport}
+}
+
+// tlsFor returns the TLS config of the connections to address(<ip>:<port>), the server certificate is verified
+// against the host name the address was resolved from. It returns nil when TLS is disabled.
+func (c *ctailclient) tlsFor(address string) *tls.Config {
+	if c.tlsConfig == nil {
+		return nil
+	}
+	config := c.tlsConfig.Clone()
+	config.ServerName = c.serverNames[address]
+	return config
+}
+
+func loadTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		content, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", caFile)
+		}
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,120 @@
+package ctailclient
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sciffer/tail/tail-client/query"
+	"gopkg.in/olivere/elastic.v6"
+)
+
+// The operators of the -where conditions
+const (
+	whereEquals    = "="
+	whereNotEquals = "!="
+	whereMatches   = "=~"
+	whereIn        = "in"
+)
+
+// whereInPattern matches the `key in (a,b)` form of the -where conditions
+var whereInPattern = regexp.MustCompile(`^\s*([^\s=!~]+)\s+in\s*\((.*)\)\s*$`)
+
+// whereCondition is a condition on the value found at a dotted json path of the messages, for arrays any
+// of the elements may match. Regular expressions must match the whole value, the way elasticsearch does.
+type whereCondition struct {
+	field  string
+	path   []string
+	op     string
+	values []string
+	regex  *regexp.Regexp
+}
+
+// parseWhere parses a condition of the form key=value, key!=value, key=~regex or key in (a,b)
+func parseWhere(expr string) (whereCondition, error) {
+	cond := whereCondition{}
+	if match := whereInPattern.FindStringSubmatch(expr); match != nil {
+		cond.field, cond.op = match[1], whereIn
+		for _, value := range strings.Split(match[2], ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				cond.values = append(cond.values, value)
+			}
+		}
+		if len(cond.values) == 0 {
+			return cond, fmt.Errorf("no values in ()")
+		}
+	} else {
+		i := strings.IndexAny(expr, "!=")
+		if i == -1 {
+			return cond, fmt.Errorf("expected key=value, key!=value, key=~regex or key in (a,b)")
+		}
+		cond.field = strings.TrimSpace(expr[:i])
+		rest := expr[i:]
+		switch {
+		case strings.HasPrefix(rest, whereNotEquals):
+			cond.op = whereNotEquals
+		case strings.HasPrefix(rest, whereMatches):
+			cond.op = whereMatches
+		case strings.HasPrefix(rest, whereEquals):
+			cond.op = whereEquals
+		default:
+			return cond, fmt.Errorf("unknown operator %q", rest)
+		}
+		cond.values = []string{strings.TrimSpace(rest[len(cond.op):])}
+	}
+	if cond.field == "" {
+		return cond, fmt.Errorf("missing key")
+	}
+	cond.path = strings.Split(cond.field, ".")
+	if cond.op == whereMatches {
+		if _, err := regexp.Compile(cond.values[0]); err != nil {
+			return cond, err
+		}
+		cond.regex = regexp.MustCompile("^(?:" + cond.values[0] + ")$")
+	}
+	return cond, nil
+}
+
+// Match returns true if jsonmsg satisfies the condition, messages missing the key only match != conditions
+func (w whereCondition) Match(jsonmsg map[string]interface{}) bool {
+	values := query.Values(jsonmsg, w.path)
+	switch w.op {
+	case whereNotEquals:
+		for _, value := range values {
+			if value == w.values[0] {
+				return false
+			}
+		}
+		return true
+	case whereMatches:
+		for _, value := range values {
+			if w.regex.MatchString(value) {
+				return true
+			}
+		}
+		return false
+	default:
+		for _, value := range values {
+			if includes(w.values, value) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Query returns the elasticsearch query of the condition on the keyword field of its path
+func (w whereCondition) Query() elastic.Query {
+	field := w.field + ".keyword"
+	terms := make([]interface{}, len(w.values))
+	for i, val := range w.values {
+		terms[i] = val
+	}
+	switch w.op {
+	case whereNotEquals:
+		return elastic.NewBoolQuery().MustNot(elastic.NewTermsQuery(field, terms...))
+	case whereMatches:
+		return elastic.NewRegexpQuery(field, w.values[0])
+	}
+	return elastic.NewTermsQuery(field, terms...)
+}
@@ -0,0 +1,87 @@
+package ctailclient
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseWhere(t *testing.T) {
+	tests := []struct {
+		expr   string
+		field  string
+		op     string
+		values []string
+		err    bool
+	}{
+		{expr: "level=ERROR", field: "level", op: whereEquals, values: []string{"ERROR"}},
+		{expr: " level = ERROR ", field: "level", op: whereEquals, values: []string{"ERROR"}},
+		{expr: "level!=DEBUG", field: "level", op: whereNotEquals, values: []string{"DEBUG"}},
+		{expr: "kubernetes.pod_name=~checkout-.*", field: "kubernetes.pod_name", op: whereMatches, values: []string{"checkout-.*"}},
+		{expr: "url=/a?b=c", field: "url", op: whereEquals, values: []string{"/a?b=c"}},
+		{expr: "level in (ERROR, WARN,)", field: "level", op: whereIn, values: []string{"ERROR", "WARN"}},
+		{expr: "level in(ERROR)", field: "level", op: whereIn, values: []string{"ERROR"}},
+		{expr: "level=", field: "level", op: whereEquals, values: []string{""}},
+		{expr: "level", err: true},
+		{expr: "=ERROR", err: true},
+		{expr: "level!ERROR", err: true},
+		{expr: "level in ( , )", err: true},
+		{expr: "level=~(", err: true},
+	}
+	for _, test := range tests {
+		cond, err := parseWhere(test.expr)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.expr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.expr, err)
+			continue
+		}
+		if cond.field != test.field || cond.op != test.op || !reflect.DeepEqual(cond.values, test.values) {
+			t.Errorf("%q: got %q %q %q, want %q %q %q", test.expr, cond.field, cond.op, cond.values, test.field, test.op, test.values)
+		}
+	}
+}
+
+func TestWhereMatch(t *testing.T) {
+	message := `{"level":"ERROR","status":500,"ok":false,"tags":["a","b"],"kubernetes":{"pod_name":"checkout-7f9"}}`
+	var jsonmsg map[string]interface{}
+	if err := json.Unmarshal([]byte(message), &jsonmsg); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"level=ERROR", true},
+		{"level=error", false},
+		{"level!=ERROR", false},
+		{"level!=WARN", true},
+		{"status=500", true},
+		{"ok=false", true},
+		{"tags=b", true},
+		{"tags!=b", false},
+		{"tags in (c, a)", true},
+		{"tags in (c)", false},
+		{"kubernetes.pod_name=~checkout-.*", true},
+		{"kubernetes.pod_name=~checkout", false},
+		{"kubernetes.pod_name=~.*7f9|other", true},
+		{"kubernetes=checkout-7f9", false},
+		{"missing=x", false},
+		{"missing!=x", true},
+		{"missing=~.*", false},
+	}
+	for _, test := range tests {
+		cond, err := parseWhere(test.expr)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %s", test.expr, err)
+			continue
+		}
+		if got := cond.Match(jsonmsg); got != test.want {
+			t.Errorf("%q: got %v, want %v", test.expr, got, test.want)
+		}
+	}
+}
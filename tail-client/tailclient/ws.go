@@ -0,0 +1,104 @@
+package ctailclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+	"github.com/sciffer/sse"
+)
+
+// wsFrame is a json text frame of the ctail server /ws endpoint, Type is "message" for stream messages
+// and the control event name otherwise.
+type wsFrame struct {
+	Type   string          `json:"type"`
+	Stream string          `json:"stream"`
+	ID     string          `json:"id"`
+	Data   json.RawMessage `json:"data"`
+	Error  string          `json:"error"`
+}
+
+// wsURL returns the /ws url of endpoint with the query parameters
+func wsURL(endpoint string, query url.Values) string {
+	wsEndpoint := "ws" + endpoint[len("http"):] // http -> ws, https -> wss
+	if len(query) > 0 {
+		return wsEndpoint + "/ws?" + query.Encode()
+	}
+	return wsEndpoint + "/ws"
+}
+
+// consumeWS reads the stream from the /ws endpoint until it fails, the frames are dispatched as events
+// so the rest of the client handles both transports the same way.
+func (conn *connection) consumeWS(output chan *streamEvent, reconnect bool, onConnect func()) error {
+	wsurl, err := url.Parse(conn.eventsURL)
+	if err != nil {
+		return err
+	}
+	query := wsurl.Query()
+	query.Set("stream", conn.stream)
+	wsurl.RawQuery = query.Encode()
+	ctx, cancel, err := conn.begin()
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	conn.mu.Lock()
+	lastEventID := conn.lastEventID
+	conn.mu.Unlock()
+	header := http.Header{}
+	if conn.token != "" {
+		header.Set("Authorization", "Bearer "+conn.token)
+	}
+	if lastEventID != "" {
+		header.Set("Last-Event-ID", lastEventID)
+	}
+
+	dialer := *websocket.DefaultDialer
+	dialer.TLSClientConfig = conn.tlsConfig
+	ws, resp, err := dialer.DialContext(ctx, wsurl.String(), header)
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("unexpected status: %s", resp.Status)
+		}
+		return err
+	}
+	defer ws.Close()
+	go func() {
+		// unblock the read when the connection is closed
+		<-ctx.Done()
+		ws.Close()
+	}()
+
+	conn.onConnected(output, reconnect, lastEventID, onConnect)
+
+	for {
+		frame := wsFrame{}
+		if err := ws.ReadJSON(&frame); err != nil {
+			if websocket.IsCloseError(err, websocket.CloseGoingAway) {
+				return fmt.Errorf("server is shutting down")
+			}
+			return err
+		}
+		switch frame.Type {
+		case shutdownEvent:
+			return fmt.Errorf("server is shutting down")
+		case "error":
+			return fmt.Errorf("server error: %s", frame.Error)
+		case "message":
+			conn.dispatch(&sse.Event{ID: []byte(frame.ID), Data: frameData(frame.Data)}, output)
+		default:
+			conn.dispatch(&sse.Event{ID: []byte(frame.ID), Event: []byte(frame.Type), Data: frameData(frame.Data)}, output)
+		}
+	}
+}
+
+// frameData returns the message embedded in a frame, messages that aren't json objects are embedded as json strings
+func frameData(data json.RawMessage) []byte {
+	var text string
+	if len(data) > 0 && data[0] == '"' && json.Unmarshal(data, &text) == nil {
+		return []byte(text)
+	}
+	return data
+}
@@ -0,0 +1,108 @@
+package ctailgrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+
+	"github.com/sciffer/tail/tailpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client is a typed client of the tail-server gRPC streaming API.
+type Client struct {
+	conn *grpc.ClientConn
+	tail tailpb.TailClient
+}
+
+// Dial connects to the gRPC endpoint of a tail-server(<host>:<port>), additional dial options
+// like transport credentials override the defaults.
+func Dial(address string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, tail: tailpb.NewTailClient(conn)}, nil
+}
+
+// WithTLS connects over TLS with config, for servers serving the gRPC API over TLS
+func WithTLS(config *tls.Config) grpc.DialOption {
+	return grpc.WithTransportCredentials(credentials.NewTLS(config))
+}
+
+// WithToken sends token as bearer token with every call, for servers that require authentication
+func WithToken(token string) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(bearerToken(token))
+}
+
+// bearerToken is a per call credential, it is allowed on insecure connections as the servers may be behind a TLS proxy
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if t == "" {
+		return nil, nil
+	}
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
+
+// ListServices returns the services known to the server
+func (c *Client) ListServices(ctx context.Context) ([]*tailpb.Service, error) {
+	res, err := c.tail.ListServices(ctx, &tailpb.ListServicesRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return res.Services, nil
+}
+
+// Subscription is the event stream of a service.
+type Subscription struct {
+	stream tailpb.Tail_SubscribeClient
+}
+
+// Recv returns the next event, io.EOF when the server ended the stream and the status error(UNAVAILABLE)
+// when it shuts down.
+func (s *Subscription) Recv() (*tailpb.Event, error) {
+	return s.stream.Recv()
+}
+
+// Subscribe streams the events of service matching filter(nil matches all) until ctx is canceled,
+// since resumes after an event id or from an RFC3339 time. It returns once the server accepted the subscription.
+func (c *Client) Subscribe(ctx context.Context, service string, filter *tailpb.Filter, since string) (*Subscription, error) {
+	stream, err := c.tail.Subscribe(ctx, &tailpb.SubscribeRequest{Service: service, Filter: filter, Since: since})
+	if err != nil {
+		return nil, err
+	}
+	// the server sends the headers once subscribed, without headers the status tells why it refused
+	header, err := stream.Header()
+	if err != nil {
+		return nil, err
+	}
+	if header == nil {
+		if _, err := stream.Recv(); err != nil {
+			return nil, err
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &Subscription{stream: stream}, nil
+}
+
+// GetRecent returns up to limit of the latest retained events of service matching filter, oldest first
+func (c *Client) GetRecent(ctx context.Context, service string, filter *tailpb.Filter, limit int) ([]*tailpb.Event, error) {
+	res, err := c.tail.GetRecent(ctx, &tailpb.GetRecentRequest{Service: service, Filter: filter, Limit: int32(limit)})
+	if err != nil {
+		return nil, err
+	}
+	return res.Events, nil
+}
+
+// Close closes the connection to the server
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/sciffer/tail/tail-server/tailserver"
 )
@@ -12,19 +14,92 @@ var (
 
 	brokerList = flag.String("brokers", "broker1:9092,broker2:9092,sbroker3:9092", "The comma separated list of brokers in the Kafka cluster")
 	topic      = flag.String("topic", "tail", "the topic to consume")
+	offset     = flag.String("offset", "committed", "Where to start consuming the topic from: oldest, newest, committed or an RFC3339 timestamp(like 2019-06-01T13:00:00Z) to replay from, use a dedicated -group when replaying.")
 	group      = flag.String("group", "tail", "The kafka group of the tail server cluster. within the same group ctail servers will shard the messages between themselves.")
 	verbose    = flag.Bool("verbose", false, "Whether to turn on sarama logging")
-	bufferSize = flag.Int("buffer-size", 256, "The buffer size of the message channel.")
+	bufferSize = flag.Int("buffer-size", 256, "The buffer size of the message channel and of the queue of every subscriber.")
+	overflow   = flag.String("overflow", "drop-oldest", "What to do when the queue of a slow subscriber is full: drop-oldest, drop-newest or disconnect(the subscriber resumes from the replay buffer).")
+	replaySize = flag.Int("replay-size", 1000, "The amount of messages retained per service for reconnecting clients(Last-Event-ID/since), 0 disables replay.")
+	serviceTTL = flag.Duration("service-ttl", 24*time.Hour, "How long an idle service is kept in /services before being evicted, 0 keeps services forever.")
 	uri        = flag.String("uri", "/events", "The events URI prefix.")
 	listen     = flag.String("listen", ":8080", "Endpoint to open for event streams.")
+	grpcListen = flag.String("grpc-listen", "", "Endpoint to serve the gRPC streaming API on, like: :9090 - disabled when empty.")
+	shutdown   = flag.Duration("shutdown-timeout", 15*time.Second, "The deadline for draining subscribers, committing offsets and closing the sources on SIGTERM.")
+	source     = flag.String("source", "kafka", "The message source to consume: kafka, file or none(when only syslog/ingest are used).")
+	file       = flag.String("file", "-", "The newline delimited json file to read messages from when -source is file, - reads from stdin.")
+	syslogUDP  = flag.String("syslog-udp", "", "UDP endpoint to listen on for syslog(RFC 5424/3164) messages, like: :514 - disabled when empty.")
+	syslogTCP  = flag.String("syslog-tcp", "", "TCP endpoint to listen on for syslog(RFC 5424/3164) messages, like: :514 - disabled when empty.")
+	routeField = flag.String("route-field", "app", "Comma separated dotted json paths of the service key, the first one found is used, like: kubernetes.labels.app,app")
+	ownerField = flag.String("owner-field", "owner,obowner", "Comma separated dotted json paths of the owner key, the first one found is used.")
+	ingest     = flag.Bool("ingest", false, "Whether to accept NDJSON messages posted to /ingest(optionally gzip encoded).")
+	peers      = flag.String("peers", "", "Comma separated list of peer tail-servers(<host>:<port> or urls) to aggregate, like the servers of a cluster or remote regions - use with -source none for a proxy.")
+	peerToken  = flag.String("peer-token-file", "", "File holding the bearer token used to authenticate to the -peers.")
+	peerCA     = flag.String("peer-ca", "", "PEM CA certificates file to verify the https -peers with, the system CAs are used when empty.")
+	peerCert   = flag.String("peer-cert", "", "PEM client certificate file to present to the https -peers, requires -peer-key.")
+	peerKey    = flag.String("peer-key", "", "PEM private key file of -peer-cert.")
+	tokenFile  = flag.String("token-file", "", "CSV file of static bearer tokens(token,user,\"group1,group2\") required on the events, services and metrics endpoints.")
+	jwtSecret  = flag.String("jwt-secret-file", "", "File holding the secret of the HS256 JWT bearer tokens(sub: user, groups: groups) required on the events, services and metrics endpoints.")
+	tlsCert    = flag.String("tls-cert", "", "PEM certificate file to serve the http and gRPC listeners over TLS with, requires -tls-key.")
+	tlsKey     = flag.String("tls-key", "", "PEM private key file of -tls-cert.")
+	tlsCA      = flag.String("tls-client-ca", "", "PEM CA certificates file, when set clients(including health probes) must present a certificate signed by one of them.")
+	kafkaTLS   = flag.Bool("kafka-tls", false, "Whether to connect to the kafka brokers over TLS.")
+	kafkaCA    = flag.String("kafka-ca", "", "PEM CA certificates file to verify the kafka brokers with, the system CAs are used when empty(for -kafka-tls only).")
+	kafkaCert  = flag.String("kafka-cert", "", "PEM client certificate file to present to the kafka brokers, requires -kafka-key(for -kafka-tls only).")
+	kafkaKey   = flag.String("kafka-key", "", "PEM private key file of -kafka-cert(for -kafka-tls only).")
+	kafkaSASL  = flag.String("kafka-sasl", "", "The SASL mechanism to authenticate to the kafka brokers with: PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512 - disabled when empty.")
+	kafkaUser  = flag.String("kafka-user", "", "The SASL user(for -kafka-sasl only).")
+	kafkaPass  = flag.String("kafka-password-file", "", "File holding the SASL password(for -kafka-sasl only).")
+	authRules  = flag.String("auth-rules", "", "JSON file of the authorization rules: {\"rules\":[{\"users\":[..],\"groups\":[..],\"services\":[globs],\"owners\":[..]}]}, without it every authenticated caller may tail every service.")
 )
 
 func main() {
 	fmt.Printf("Tail-server %s\n", version)
 	flag.Parse()
 
-	server := ctailserver.NewCtailServer(*verbose, *bufferSize)
-	server.InitConsumer(*brokerList, *topic, *group)
+	server := ctailserver.NewCtailServer(*verbose, *bufferSize, *replaySize, *serviceTTL)
+	server.SetRouting(*routeField, *ownerField)
+	server.SetOverflow(*overflow)
+	server.SetAuth(*tokenFile, *jwtSecret, *authRules)
+	server.SetTLS(*tlsCert, *tlsKey, *tlsCA)
+	if *kafkaTLS {
+		server.SetKafkaTLS(*kafkaCA, *kafkaCert, *kafkaKey)
+	} else if *kafkaCA != "" || *kafkaCert != "" || *kafkaKey != "" {
+		printUsageErrorAndExit("-kafka-ca, -kafka-cert and -kafka-key require -kafka-tls")
+	}
+	if *kafkaSASL != "" {
+		server.SetKafkaSASL(*kafkaSASL, *kafkaUser, *kafkaPass)
+	}
+	switch *source {
+	case "kafka":
+		server.InitConsumer(*brokerList, *topic, *group, *offset)
+	case "file":
+		server.InitFileSource(*file)
+	case "none":
+	default:
+		printUsageErrorAndExit("-source should be `kafka`, `file` or `none`")
+	}
+	if *syslogUDP != "" || *syslogTCP != "" {
+		server.InitSyslog(*syslogUDP, *syslogTCP)
+	}
+	if *ingest {
+		server.InitIngest()
+	}
+	if *peers != "" {
+		server.InitPeers(*peers, *uri, *peerToken, *peerCA, *peerCert, *peerKey)
+	} else if *peerCA != "" || *peerCert != "" || *peerKey != "" {
+		printUsageErrorAndExit("-peer-ca, -peer-cert and -peer-key require -peers")
+	}
+	if *grpcListen != "" {
+		server.StartGRPC(*grpcListen)
+	}
 	server.StartHTTP(*uri, *listen)
-	server.StartConsuming()
+	server.StartConsuming(*shutdown)
+}
+
+func printUsageErrorAndExit(format string, values ...interface{}) {
+	fmt.Fprintf(os.Stderr, "ERROR: %s\n", fmt.Sprintf(format, values...))
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Available command line options:")
+	flag.PrintDefaults()
+	os.Exit(64)
 }
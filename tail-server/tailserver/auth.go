@@ -0,0 +1,282 @@
+package ctailserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// principal is an authenticated caller.
+type principal struct {
+	User   string
+	Groups []string
+}
+
+// authRule allows the users and groups it lists(* for anyone authenticated) to tail the services
+// matching one of its service globs or owned by one of its owners.
+type authRule struct {
+	Users    []string `json:"users"`
+	Groups   []string `json:"groups"`
+	Services []string `json:"services"`
+	Owners   []string `json:"owners"`
+}
+
+// auth authenticates bearer tokens, either static tokens or HS256 signed JWTs, and authorizes the
+// authenticated principals per service. Without rules every authenticated principal may tail every service.
+type auth struct {
+	tokens    map[string]*principal
+	jwtSecret []byte
+	rules     []authRule
+}
+
+type principalKey struct{}
+
+// loadAuth loads the static tokens file(csv lines of: token,user,"group1,group2"), the JWT secret file
+// and the json authorization rules file({"rules":[...]}), empty paths are skipped.
+func loadAuth(tokenFile string, jwtSecretFile string, rulesFile string) (*auth, error) {
+	a := &auth{tokens: make(map[string]*principal)}
+	if tokenFile != "" {
+		f, err := os.Open(tokenFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		reader := csv.NewReader(f)
+		reader.FieldsPerRecord = -1
+		reader.Comment = '#'
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", tokenFile, err)
+		}
+		for _, record := range records {
+			if len(record) < 2 || record[0] == "" {
+				return nil, fmt.Errorf("%s: expected token,user[,groups] got: %s", tokenFile, strings.Join(record, ","))
+			}
+			p := &principal{User: record[1]}
+			if len(record) > 2 && record[2] != "" {
+				p.Groups = strings.Split(record[2], ",")
+			}
+			a.tokens[record[0]] = p
+		}
+	}
+	if jwtSecretFile != "" {
+		secret, err := ioutil.ReadFile(jwtSecretFile)
+		if err != nil {
+			return nil, err
+		}
+		if a.jwtSecret = bytes.TrimSpace(secret); len(a.jwtSecret) == 0 {
+			return nil, fmt.Errorf("%s: empty JWT secret", jwtSecretFile)
+		}
+	}
+	if rulesFile != "" {
+		content, err := ioutil.ReadFile(rulesFile)
+		if err != nil {
+			return nil, err
+		}
+		rules := struct {
+			Rules []authRule `json:"rules"`
+		}{}
+		if err := json.Unmarshal(content, &rules); err != nil {
+			return nil, fmt.Errorf("%s: %s", rulesFile, err)
+		}
+		for _, rule := range rules.Rules {
+			for _, pattern := range rule.Services {
+				if _, err := path.Match(pattern, ""); err != nil {
+					return nil, fmt.Errorf("%s: invalid service pattern %s", rulesFile, pattern)
+				}
+			}
+		}
+		a.rules = rules.Rules
+	}
+	return a, nil
+}
+
+// authenticate returns the principal of a static token or a valid JWT.
+func (a *auth) authenticate(token string) (*principal, error) {
+	if token == "" {
+		return nil, fmt.Errorf("missing bearer token")
+	}
+	if p, ok := a.tokens[token]; ok {
+		return p, nil
+	}
+	if a.jwtSecret != nil && strings.Count(token, ".") == 2 {
+		return a.verifyJWT(token, time.Now())
+	}
+	return nil, fmt.Errorf("invalid token")
+}
+
+// verifyJWT checks the HS256 signature and the exp/nbf claims of token, the user is the sub claim
+// and the groups the groups claim.
+func (a *auth) verifyJWT(token string, now time.Time) (*principal, error) {
+	parts := strings.Split(token, ".")
+	header := struct {
+		Alg string `json:"alg"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+	mac := hmac.New(sha256.New, a.jwtSecret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("invalid token")
+	}
+	claims := struct {
+		Sub    string   `json:"sub"`
+		Groups []string `json:"groups"`
+		Exp    int64    `json:"exp"`
+		Nbf    int64    `json:"nbf"`
+	}{}
+	if err := decodeSegment(parts[1], &claims); err != nil || claims.Sub == "" {
+		return nil, fmt.Errorf("invalid token")
+	}
+	if claims.Exp > 0 && now.Unix() >= claims.Exp {
+		return nil, fmt.Errorf("token expired")
+	}
+	if claims.Nbf > 0 && now.Unix() < claims.Nbf {
+		return nil, fmt.Errorf("token not valid yet")
+	}
+	return &principal{User: claims.Sub, Groups: claims.Groups}, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, v)
+}
+
+// allowed returns true if p may tail service, owner is the owner last seen on the service messages.
+func (a *auth) allowed(p *principal, service string, owner string) bool {
+	if p == nil {
+		return false
+	}
+	if a.rules == nil {
+		return true
+	}
+	for _, rule := range a.rules {
+		if !rule.appliesTo(p) {
+			continue
+		}
+		for _, pattern := range rule.Services {
+			if matched, _ := path.Match(pattern, service); matched {
+				return true
+			}
+		}
+		if owner != "" && StringExists(owner, rule.Owners) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *authRule) appliesTo(p *principal) bool {
+	if StringExists("*", r.Users) || StringExists(p.User, r.Users) {
+		return true
+	}
+	for _, group := range p.Groups {
+		if StringExists(group, r.Groups) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of the Authorization header. When streaming, the access_token query parameter
+// is accepted from the EventSource/WebSocket requests of browsers, which can't set headers on them. Other
+// requests only take the header, query strings end up in access logs.
+func bearerToken(r *http.Request, streaming bool) string {
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):])
+	}
+	if streaming && browserStream(r) {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// browserStream returns true for the requests of browser EventSource and WebSocket objects
+func browserStream(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/event-stream") || strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// authenticated wraps handler so it is only served to authenticated callers, whose principal is added to the
+// request context. It is a no-op when authentication is disabled.
+func (s *ctailserver) authenticated(handler http.Handler) http.Handler {
+	return s.authenticate(handler, false)
+}
+
+// authenticatedStream is authenticated for the event streams, which browsers may authenticate with the
+// access_token query parameter.
+func (s *ctailserver) authenticatedStream(handler http.Handler) http.Handler {
+	return s.authenticate(handler, true)
+}
+
+func (s *ctailserver) authenticate(handler http.Handler, streaming bool) http.Handler {
+	if s.auth == nil {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := s.auth.authenticate(bearerToken(r, streaming))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	})
+}
+
+// authorized returns true if the principal of ctx may tail stream, always true when authentication is disabled.
+func (s *ctailserver) authorized(ctx context.Context, stream string) bool {
+	if s.auth == nil {
+		return true
+	}
+	p, _ := ctx.Value(principalKey{}).(*principal)
+	return s.auth.allowed(p, stream, s.registry.owner(stream))
+}
+
+// mayIngest returns the service value is routed to and whether the principal of ctx may ingest it, that is tail
+// the service. Known services are checked against their registered owner, so messages can't claim the owner of
+// another team to be published to its services. Always true when authentication is disabled.
+func (s *ctailserver) mayIngest(ctx context.Context, value []byte) (string, bool) {
+	service := ExtractFirst(value, s.routeFields)
+	if service == "" {
+		service = "none"
+	}
+	if s.auth == nil {
+		return service, true
+	}
+	owner := s.registry.owner(service)
+	if owner == "" {
+		owner = ExtractFirst(value, s.ownerFields)
+	}
+	p, _ := ctx.Value(principalKey{}).(*principal)
+	return service, s.auth.allowed(p, service, owner)
+}
+
+// authorizedNames returns the names the principal of ctx may tail.
+func (s *ctailserver) authorizedNames(ctx context.Context, names []string) []string {
+	allowed := []string{}
+	for _, name := range names {
+		if s.authorized(ctx, name) {
+			allowed = append(allowed, name)
+		}
+	}
+	return allowed
+}
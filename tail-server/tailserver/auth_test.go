@@ -0,0 +1,196 @@
+package ctailserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signJWT returns a JWT of the header and claims json signed with secret, signed with an empty secret is unsigned
+func signJWT(secret string, header string, claims string) string {
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(claims))
+	if secret == "" {
+		return unsigned + "."
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// tamperJWT replaces the claims of token, keeping its signature
+func tamperJWT(token string, claims string) string {
+	parts := strings.Split(token, ".")
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(claims)) + "." + parts[2]
+}
+
+func TestVerifyJWT(t *testing.T) {
+	a := &auth{jwtSecret: []byte("secret")}
+	now := time.Unix(1700000000, 0)
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	tests := []struct {
+		name  string
+		token string
+		user  string
+		err   string
+	}{
+		{name: "valid", token: signJWT("secret", hs256, `{"sub":"alice","groups":["payments"],"exp":1700000001,"nbf":1700000000}`), user: "alice"},
+		{name: "no exp nor nbf", token: signJWT("secret", hs256, `{"sub":"alice"}`), user: "alice"},
+		{name: "bad signature", token: signJWT("other", hs256, `{"sub":"alice"}`), err: "invalid token"},
+		{name: "tampered claims", token: tamperJWT(signJWT("secret", hs256, `{"sub":"alice"}`), `{"sub":"root"}`), err: "invalid token"},
+		{name: "alg none", token: signJWT("", `{"alg":"none"}`, `{"sub":"alice"}`), err: "invalid token"},
+		{name: "alg RS256", token: signJWT("secret", `{"alg":"RS256"}`, `{"sub":"alice"}`), err: "invalid token"},
+		{name: "expired", token: signJWT("secret", hs256, `{"sub":"alice","exp":1699999999}`), err: "token expired"},
+		{name: "expires now", token: signJWT("secret", hs256, `{"sub":"alice","exp":1700000000}`), err: "token expired"},
+		{name: "not valid yet", token: signJWT("secret", hs256, `{"sub":"alice","nbf":1700000001}`), err: "token not valid yet"},
+		{name: "missing sub", token: signJWT("secret", hs256, `{"groups":["admins"]}`), err: "invalid token"},
+		{name: "invalid signature encoding", token: signJWT("", hs256, `{"sub":"alice"}`) + "!", err: "invalid token"},
+		{name: "invalid claims", token: signJWT("secret", hs256, `not json`), err: "invalid token"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := a.verifyJWT(test.token, now)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Errorf("got %v, want error %q", err, test.err)
+				}
+				return
+			}
+			if err != nil || p.User != test.user {
+				t.Errorf("got %+v, %v - want user %q", p, err, test.user)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := &auth{tokens: map[string]*principal{"static": {User: "ci"}}, jwtSecret: []byte("secret")}
+	if p, err := a.authenticate("static"); err != nil || p.User != "ci" {
+		t.Errorf("static token: got %+v, %v", p, err)
+	}
+	if p, err := a.authenticate(signJWT("secret", `{"alg":"HS256"}`, `{"sub":"alice"}`)); err != nil || p.User != "alice" {
+		t.Errorf("jwt: got %+v, %v", p, err)
+	}
+	for _, token := range []string{"", "unknown", "a.b", signJWT("other", `{"alg":"HS256"}`, `{"sub":"alice"}`)} {
+		if _, err := a.authenticate(token); err == nil {
+			t.Errorf("%q: expected an error", token)
+		}
+	}
+}
+
+// testRules are the rules of the authorization tests
+var testRules = []authRule{
+	{Users: []string{"alice"}, Services: []string{"checkout-*"}},
+	{Groups: []string{"payments"}, Owners: []string{"team-payments"}},
+	{Users: []string{"root"}, Services: []string{"*"}},
+	{Users: []string{"*"}, Services: []string{"public"}},
+}
+
+func TestAllowed(t *testing.T) {
+	alice := &principal{User: "alice"}
+	bob := &principal{User: "bob", Groups: []string{"payments"}}
+	root := &principal{User: "root"}
+	tests := []struct {
+		name      string
+		rules     []authRule
+		principal *principal
+		service   string
+		owner     string
+		want      bool
+	}{
+		{name: "glob rule", rules: testRules, principal: alice, service: "checkout-api", want: true},
+		{name: "glob rule of another user", rules: testRules, principal: bob, service: "checkout-api", want: false},
+		{name: "glob doesn't match", rules: testRules, principal: alice, service: "ledger", want: false},
+		{name: "owner rule of a group", rules: testRules, principal: bob, service: "ledger", owner: "team-payments", want: true},
+		{name: "owner rule of another group", rules: testRules, principal: alice, service: "ledger", owner: "team-payments", want: false},
+		{name: "other owner", rules: testRules, principal: bob, service: "ledger", owner: "team-search", want: false},
+		{name: "unknown owner", rules: testRules, principal: bob, service: "ledger", want: false},
+		{name: "anyone authenticated", rules: testRules, principal: &principal{User: "eve"}, service: "public", want: true},
+		{name: "firehose of a glob rule", rules: testRules, principal: alice, service: firehoseStream, want: false},
+		{name: "firehose of an owner rule", rules: testRules, principal: bob, service: firehoseStream, owner: "", want: false},
+		{name: "firehose of a * rule", rules: testRules, principal: root, service: firehoseStream, want: true},
+		{name: "unauthenticated", rules: testRules, principal: nil, service: "public", want: false},
+		{name: "no rules", rules: nil, principal: alice, service: "ledger", want: true},
+		{name: "no rules unauthenticated", rules: nil, principal: nil, service: "ledger", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			a := &auth{rules: test.rules}
+			if got := a.allowed(test.principal, test.service, test.owner); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMayIngest(t *testing.T) {
+	s := &ctailserver{
+		auth:        &auth{rules: testRules},
+		registry:    newRegistry(time.Hour),
+		routeFields: ParsePaths("app"),
+		ownerFields: ParsePaths("owner"),
+	}
+	s.registry.record("ledger", "team-payments", "log", "logs", 0, time.Now())
+	s.registry.record("search", "team-search", "log", "logs", 0, time.Now())
+	bob := context.WithValue(context.Background(), principalKey{}, &principal{User: "bob", Groups: []string{"payments"}})
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		message string
+		service string
+		want    bool
+	}{
+		{name: "service of the owner", ctx: bob, message: `{"app":"ledger"}`, service: "ledger", want: true},
+		{name: "known service claiming another owner", ctx: bob, message: `{"app":"search","owner":"team-payments"}`, service: "search", want: false},
+		{name: "new service of the owner", ctx: bob, message: `{"app":"billing","owner":"team-payments"}`, service: "billing", want: true},
+		{name: "new service of another owner", ctx: bob, message: `{"app":"billing","owner":"team-search"}`, service: "billing", want: false},
+		{name: "no service", ctx: bob, message: `{"message":"x"}`, service: "none", want: false},
+		{name: "unauthenticated", ctx: context.Background(), message: `{"app":"public"}`, service: "public", want: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			service, ok := s.mayIngest(test.ctx, []byte(test.message))
+			if service != test.service || ok != test.want {
+				t.Errorf("got %q, %v - want %q, %v", service, ok, test.service, test.want)
+			}
+		})
+	}
+
+	s.auth = nil
+	if service, ok := s.mayIngest(context.Background(), []byte(`{"app":"search"}`)); service != "search" || !ok {
+		t.Errorf("got %q, %v without authentication, want allowed", service, ok)
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		headers   map[string]string
+		streaming bool
+		want      string
+	}{
+		{name: "header", url: "/services", headers: map[string]string{"Authorization": "Bearer abc "}, want: "abc"},
+		{name: "header over query", url: "/events?access_token=q", headers: map[string]string{"Authorization": "Bearer abc", "Accept": "text/event-stream"}, streaming: true, want: "abc"},
+		{name: "query of an EventSource", url: "/events?access_token=q", headers: map[string]string{"Accept": "text/event-stream"}, streaming: true, want: "q"},
+		{name: "query of a WebSocket", url: "/ws?access_token=q", headers: map[string]string{"Upgrade": "websocket"}, streaming: true, want: "q"},
+		{name: "query of a non browser stream", url: "/events?access_token=q", streaming: true, want: ""},
+		{name: "query of another endpoint", url: "/metrics?access_token=q", headers: map[string]string{"Accept": "text/event-stream"}, want: ""},
+		{name: "other scheme", url: "/services", headers: map[string]string{"Authorization": "Basic abc"}, want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", test.url, nil)
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+			if got := bearerToken(r, test.streaming); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,554 @@
+package ctailserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// broker fans the published messages of each stream out to its SSE subscribers,
+// every subscriber carries its own filter so only matching messages leave the server.
+// The last replaySize messages of every stream are retained so reconnecting subscribers can resume.
+// Firehose subscribers receive the messages of all the streams, without replay.
+// Publishing never waits for subscribers, the queue of a subscriber that can't keep up overflows as per the overflow policy.
+type broker struct {
+	mu         sync.Mutex
+	streams    map[string]*stream
+	firehose   map[*subscriber]struct{}
+	bufferSize int
+	replaySize int
+	overflow   string
+	epoch      int64
+	keepalive  time.Duration // interval of the comments keeping idle event streams open
+	closing    chan struct{}
+	// authorize tells if the caller of ctx may subscribe to stream, nil allows everyone
+	authorize   func(ctx context.Context, stream string) bool
+	dropped     *prometheus.CounterVec
+	subscribers *prometheus.GaugeVec
+	published   *prometheus.CounterVec
+	sentBytes   *prometheus.CounterVec
+}
+
+const (
+	// gapEvent tells a resuming subscriber how many messages were evicted from the replay buffer
+	gapEvent = "ctail-gap"
+	// shutdownEvent is the last event sent to subscribers when the server shuts down, so they fail over
+	shutdownEvent = "ctail-shutdown"
+	// rebalanceEvent tells subscribers the kafka partitions moved between servers, so they re-route
+	rebalanceEvent = "ctail-rebalance"
+	// droppedEvent tells a slow subscriber how many messages were dropped from its queue
+	droppedEvent = "ctail-dropped"
+
+	// overflow policies of the subscriber queues: drop the oldest queued message, drop the new message
+	// or disconnect the subscriber, which can then resume from the replay buffer
+	overflowDropOldest = "drop-oldest"
+	overflowDropNewest = "drop-newest"
+	overflowDisconnect = "disconnect"
+
+	// controlQueueSize is the number of control events queued per subscriber, apart from its messages
+	controlQueueSize = 4
+
+	// sseKeepaliveInterval is shorter than the idle timeouts of the common proxies and load balancers
+	sseKeepaliveInterval = 15 * time.Second
+)
+
+// stream holds the subscribers and replay history of a single service stream.
+type stream struct {
+	subscribers map[*subscriber]struct{}
+	seq         uint64
+	history     []*message // ring buffer of the last replaySize messages
+	next        int        // position of the next write in history
+}
+
+// message is a single server-sent event, name is empty for regular stream messages.
+type message struct {
+	id       uint64
+	name     string
+	data     []byte
+	event    bool // tagged EVENT, a log otherwise
+	received time.Time
+}
+
+type subscriber struct {
+	sent     int64 // updated atomically by the subscriber goroutine, first for 64-bit alignment
+	stream   string
+	filter   filter
+	messages chan *message // bounded queue of bufferSize messages
+	control  chan *message // control events, queued apart from the messages so overflowing never drops them
+	// overflowed is signaled when messages are dropped, dropped and disconnected are guarded by the broker mutex
+	overflowed   chan struct{}
+	dropped      int64
+	droppedTotal int64
+	disconnected bool
+	conn         connInfo
+	connected    time.Time
+}
+
+func newBroker(bufferSize int, replaySize int) *broker {
+	if bufferSize < 1 {
+		bufferSize = 1 // overflowing needs a queue
+	}
+	return &broker{
+		streams:    make(map[string]*stream),
+		firehose:   make(map[*subscriber]struct{}),
+		bufferSize: bufferSize,
+		replaySize: replaySize,
+		overflow:   overflowDropOldest,
+		epoch:      time.Now().Unix(),
+		keepalive:  sseKeepaliveInterval,
+		closing:    make(chan struct{}),
+		dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ctail_dropped_messages",
+			Help: "Number of messages dropped from the queues of slow subscribers(per service).",
+		},
+			[]string{"service"}),
+		subscribers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "ctail_subscribers",
+			Help: "Number of connected subscribers(per service, * for the firehose).",
+		},
+			[]string{"service"}),
+		published: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ctail_published_bytes",
+			Help: "Number of message bytes published by this ctail server since startup(per service).",
+		},
+			[]string{"service"}),
+		sentBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ctail_sent_bytes",
+			Help: "Number of message bytes sent to subscribers since startup(per service, * for the firehose).",
+		},
+			[]string{"service"}),
+	}
+}
+
+// getStream returns the stream of name, creating it. The history grows as messages are published, so
+// streams that are only subscribed to(like misspelled or random names) cost no replay buffer.
+func (b *broker) getStream(name string) *stream {
+	st, ok := b.streams[name]
+	if !ok {
+		st = &stream{subscribers: make(map[*subscriber]struct{})}
+		b.streams[name] = st
+	}
+	return st
+}
+
+// forgetStream removes the stream of name and its subscribers gauge once it has no subscribers and nothing
+// was ever published to it, it is called with the mutex held. Published streams expire with their service.
+func (b *broker) forgetStream(name string) {
+	if st, ok := b.streams[name]; ok && len(st.subscribers) == 0 && st.seq == 0 {
+		delete(b.streams, name)
+		b.subscribers.Delete(prometheus.Labels{"service": name})
+	}
+}
+
+// Close stops accepting new subscribers and ends the connected ones with a shutdown event.
+func (b *broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.closing:
+	default:
+		close(b.closing)
+	}
+}
+
+// setFilter replaces the filter of a subscriber, the messages already queued for it are not filtered again.
+func (b *broker) setFilter(sub *subscriber, f filter) {
+	b.mu.Lock()
+	sub.filter = f
+	b.mu.Unlock()
+}
+
+// subscriberCounts returns the number of subscribers of every stream that has any.
+func (b *broker) subscriberCounts() map[string]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	counts := make(map[string]int)
+	for name, st := range b.streams {
+		if len(st.subscribers) > 0 {
+			counts[name] = len(st.subscribers)
+		}
+	}
+	if len(b.firehose) > 0 {
+		counts[firehoseStream] = len(b.firehose)
+	}
+	return counts
+}
+
+// removeStream drops the replay history of a stream nobody is subscribed to.
+func (b *broker) removeStream(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if st, ok := b.streams[name]; ok && len(st.subscribers) == 0 {
+		delete(b.streams, name)
+		b.subscribers.Delete(prometheus.Labels{"service": name})
+	}
+}
+
+// Publish assigns the next event id of stream to data, retains it for replay and
+// sends it to all the subscribers of stream whose filter matches it, and to the firehose unless
+// firehose is false(for messages received from peers, so aggregating proxies don't loop).
+// event tells if data is an event or a log, for the subscribers filtering on the type.
+func (b *broker) Publish(name string, data []byte, event bool, firehose bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	st := b.getStream(name)
+	st.seq++
+	msg := &message{id: st.seq, data: data, event: event, received: time.Now()}
+	b.published.With(prometheus.Labels{"service": name}).Add(float64(len(data)))
+	if b.replaySize > 0 {
+		if len(st.history) < b.replaySize {
+			st.history = append(st.history, msg)
+		} else {
+			st.history[st.next] = msg
+		}
+		st.next = (st.next + 1) % b.replaySize
+	}
+
+	for sub := range st.subscribers {
+		b.send(sub, msg)
+	}
+	if firehose {
+		for sub := range b.firehose {
+			b.send(sub, msg)
+		}
+	}
+}
+
+// send delivers msg to sub if its filter matches
+func (b *broker) send(sub *subscriber, msg *message) {
+	if sub.filter != nil && !sub.filter.match(msg) {
+		return
+	}
+	b.enqueue(sub, msg)
+}
+
+// enqueue adds msg to the queue of sub without waiting, a full queue overflows as per the overflow policy.
+// It is called with the mutex held, so only the subscriber can make room meanwhile.
+func (b *broker) enqueue(sub *subscriber, msg *message) {
+	if sub.disconnected {
+		return
+	}
+	select {
+	case sub.messages <- msg:
+		return
+	default:
+	}
+	switch b.overflow {
+	case overflowDropOldest:
+		evicted := false
+		select {
+		case <-sub.messages:
+			evicted = true
+		default: // the subscriber just made room
+		}
+		sub.messages <- msg
+		if !evicted {
+			return
+		}
+	case overflowDisconnect:
+		sub.disconnected = true
+	}
+	sub.dropped++
+	sub.droppedTotal++
+	b.dropped.With(prometheus.Labels{"service": sub.stream}).Inc()
+	select {
+	case sub.overflowed <- struct{}{}:
+	default: // a pending signal already covers it
+	}
+}
+
+// takeDropped returns the number of messages dropped for sub since the last call and whether
+// the disconnect policy ended the subscription, subscribers call it when overflowed is signaled.
+func (b *broker) takeDropped(sub *subscriber) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	dropped := sub.dropped
+	sub.dropped = 0
+	return dropped, sub.disconnected
+}
+
+// droppedNotice is the in-band event telling a subscriber about dropped messages
+func droppedNotice(dropped int64) *message {
+	return &message{name: droppedEvent, data: []byte(fmt.Sprintf("{\"dropped\":%d}", dropped)), received: time.Now()}
+}
+
+// Broadcast sends a control event to the subscribers of all the streams and of the firehose,
+// it is not retained for replay.
+func (b *broker) Broadcast(name string, data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msg := &message{name: name, data: data, received: time.Now()}
+	for _, st := range b.streams {
+		for sub := range st.subscribers {
+			b.sendControl(sub, msg)
+		}
+	}
+	for sub := range b.firehose {
+		b.sendControl(sub, msg)
+	}
+}
+
+// sendControl queues the control event msg for sub apart from its messages, so it is delivered whatever the
+// overflow policy and never counted as dropped. A full control queue makes room by evicting its oldest event,
+// the control events carry the whole state(like the assignment) so the newest one supersedes it.
+// It is called with the mutex held, so only the subscriber can make room meanwhile.
+func (b *broker) sendControl(sub *subscriber, msg *message) {
+	if sub.disconnected {
+		return
+	}
+	for {
+		select {
+		case sub.control <- msg:
+			return
+		default:
+		}
+		select {
+		case <-sub.control:
+		default: // the subscriber just made room
+		}
+	}
+}
+
+// replay returns the retained messages of st that follow the resume point, oldest first,
+// and the number of messages that were already evicted from the buffer (-1 when unknown).
+func (b *broker) replay(st *stream, since resumePoint) ([]*message, int64) {
+	history := make([]*message, 0, len(st.history))
+	if len(st.history) == b.replaySize {
+		history = append(history, st.history[st.next:]...)
+		history = append(history, st.history[:st.next]...)
+	} else {
+		history = append(history, st.history...)
+	}
+
+	var missed int64
+	start := len(history)
+	for i, msg := range history {
+		if since.after(msg, b.epoch) {
+			start = i
+			break
+		}
+	}
+	switch {
+	case since.id > 0 && since.epoch != b.epoch:
+		missed = -1 // the server restarted since, ids are not comparable
+	case since.id > 0 && len(history) > 0 && history[0].id > since.id+1:
+		missed = int64(history[0].id - since.id - 1)
+	case since.id > 0 && len(history) == 0 && st.seq > since.id:
+		missed = int64(st.seq - since.id)
+	}
+	return history[start:], missed
+}
+
+// recent returns the last limit retained messages of stream matching f, oldest first, 0 returns all of them.
+func (b *broker) recent(name string, f filter, limit int) []*message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, ok := b.streams[name]
+	if !ok {
+		return nil
+	}
+	history, _ := b.replay(st, resumePoint{})
+	recent := []*message{}
+	for i := len(history) - 1; i >= 0 && (limit <= 0 || len(recent) < limit); i-- {
+		if f == nil || f.match(history[i]) {
+			recent = append(recent, history[i])
+		}
+	}
+	for i, j := 0, len(recent)-1; i < j; i, j = i+1, j-1 {
+		recent[i], recent[j] = recent[j], recent[i]
+	}
+	return recent
+}
+
+// subscribe adds a subscriber of stream name connected over conn, it returns the retained messages following since
+// and the number of messages missed since(-1 when unknown).
+func (b *broker) subscribe(name string, f filter, since resumePoint, conn connInfo) (*subscriber, []*message, int64) {
+	sub := &subscriber{
+		stream:     name,
+		filter:     f,
+		messages:   make(chan *message, b.bufferSize),
+		control:    make(chan *message, controlQueueSize),
+		overflowed: make(chan struct{}, 1),
+		conn:       conn,
+		connected:  time.Now(),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers.With(prometheus.Labels{"service": name}).Inc()
+	if name == firehoseStream {
+		b.firehose[sub] = struct{}{}
+		return sub, nil, 0
+	}
+	st := b.getStream(name)
+	st.subscribers[sub] = struct{}{}
+	if since.isZero() {
+		return sub, nil, 0
+	}
+	replayed, missed := b.replay(st, since)
+	return sub, replayed, missed
+}
+
+// unsubscribe removes sub, the stream is forgotten when sub was the last subscriber of a stream nothing was published to
+func (b *broker) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers.With(prometheus.Labels{"service": sub.stream}).Dec()
+	if sub.stream == firehoseStream {
+		delete(b.firehose, sub)
+	} else if st, ok := b.streams[sub.stream]; ok {
+		delete(st.subscribers, sub)
+		b.forgetStream(sub.stream)
+	}
+}
+
+// HTTPHandler streams the messages of the requested stream(* for all the streams) as server-sent events,
+// the pod/podid/env/rev/cluster/level/type query parameters are evaluated per subscriber.
+// Subscribers resume from the Last-Event-ID header or the since query parameter(event id or RFC3339 time).
+// A comment is sent every keepalive interval, so proxies don't cut the streams of quiet services.
+func (b *broker) HTTPHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported!", http.StatusInternalServerError)
+		return
+	}
+	name := r.URL.Query().Get("stream")
+	if name == "" {
+		http.Error(w, "Please specify a stream!", http.StatusBadRequest)
+		return
+	}
+	if b.authorize != nil && !b.authorize(r.Context(), name) {
+		http.Error(w, "Not authorized to tail "+name, http.StatusForbidden)
+		return
+	}
+	since := r.Header.Get("Last-Event-ID")
+	if since == "" {
+		since = r.URL.Query().Get("since")
+	}
+	resume, err := parseResumePoint(since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case <-b.closing:
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	sub, replayed, missed := b.subscribe(name, parseFilter(r.URL.Query()), resume, newConnInfo(r.Context(), r.RemoteAddr, "sse"))
+	defer b.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if missed != 0 {
+		b.writeEvent(w, &message{name: gapEvent, data: []byte(fmt.Sprintf("{\"missed\":%d}", missed))})
+	}
+	for _, msg := range replayed {
+		if sub.filter == nil || sub.filter.match(msg) {
+			b.writeEvent(w, msg)
+			b.delivered(sub, msg)
+		}
+	}
+	flusher.Flush()
+
+	keepalive := time.NewTicker(b.keepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case msg := <-sub.messages:
+			b.writeEvent(w, msg)
+			flusher.Flush()
+			b.delivered(sub, msg)
+		case msg := <-sub.control:
+			b.writeEvent(w, msg)
+			flusher.Flush()
+		case <-sub.overflowed:
+			dropped, disconnected := b.takeDropped(sub)
+			b.writeEvent(w, droppedNotice(dropped))
+			flusher.Flush()
+			if disconnected {
+				return
+			}
+		case <-keepalive.C:
+			fmt.Fprint(w, ":\n\n")
+			flusher.Flush()
+		case <-b.closing:
+			b.writeEvent(w, &message{name: shutdownEvent, data: []byte("server-shutting-down")})
+			flusher.Flush()
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// sseNewlines normalizes the \r\n and \r line endings of the data, which would otherwise end the data fields
+var sseNewlines = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+// writeEvent writes msg in the server-sent events wire format, one data field per line.
+func (b *broker) writeEvent(w http.ResponseWriter, msg *message) {
+	if msg.id > 0 {
+		fmt.Fprintf(w, "id: %s\n", eventID(b.epoch, msg.id))
+	}
+	if msg.name != "" {
+		fmt.Fprintf(w, "event: %s\n", msg.name)
+	}
+	for _, line := range strings.Split(sseNewlines.Replace(string(msg.data)), "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// eventID formats the id of a message published by the broker started at epoch.
+func eventID(epoch int64, id uint64) string {
+	return fmt.Sprintf("%d-%d", epoch, id)
+}
+
+// resumePoint is where a reconnecting subscriber left off, either an event id or a point in time.
+type resumePoint struct {
+	epoch int64
+	id    uint64
+	time  time.Time
+}
+
+// parseResumePoint parses an event id(<epoch>-<seq>) or RFC3339 timestamp, empty means no replay.
+func parseResumePoint(since string) (resumePoint, error) {
+	if since == "" {
+		return resumePoint{}, nil
+	}
+	if parts := strings.SplitN(since, "-", 2); len(parts) == 2 {
+		epoch, epochErr := strconv.ParseInt(parts[0], 10, 64)
+		id, idErr := strconv.ParseUint(parts[1], 10, 64)
+		if epochErr == nil && idErr == nil {
+			return resumePoint{epoch: epoch, id: id}, nil
+		}
+	}
+	ts, err := time.Parse(time.RFC3339, since)
+	if err != nil {
+		return resumePoint{}, fmt.Errorf("since should be an event id or an RFC3339 timestamp, got: %s", since)
+	}
+	return resumePoint{time: ts}, nil
+}
+
+func (p resumePoint) isZero() bool {
+	return p.id == 0 && p.time.IsZero()
+}
+
+// after returns true if msg was published after the resume point.
+func (p resumePoint) after(msg *message, epoch int64) bool {
+	if p.id > 0 {
+		return p.epoch != epoch || msg.id > p.id
+	}
+	return msg.received.After(p.time)
+}
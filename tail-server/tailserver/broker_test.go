@@ -0,0 +1,285 @@
+package ctailserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ids returns the ids of msgs
+func ids(msgs []*message) string {
+	parts := []string{}
+	for _, msg := range msgs {
+		parts = append(parts, fmt.Sprint(msg.id))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestReplay(t *testing.T) {
+	b := newBroker(10, 3)
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		b.Publish("svc", []byte(fmt.Sprintf("m%d", i)), false, true)
+	}
+	b.mu.Lock()
+	b.streams["svc"].history[0].received = start.Add(time.Hour) // message 4
+	b.mu.Unlock()
+	tests := []struct {
+		name     string
+		since    resumePoint
+		replayed string
+		missed   int64
+	}{
+		{name: "no resume point", since: resumePoint{}, replayed: "", missed: 0},
+		{name: "last delivered retained", since: resumePoint{epoch: b.epoch, id: 3}, replayed: "4,5", missed: 0},
+		{name: "up to date", since: resumePoint{epoch: b.epoch, id: 5}, replayed: "", missed: 0},
+		{name: "evicted", since: resumePoint{epoch: b.epoch, id: 1}, replayed: "3,4,5", missed: 1},
+		{name: "restarted server", since: resumePoint{epoch: b.epoch - 1, id: 4}, replayed: "3,4,5", missed: -1},
+		{name: "time", since: resumePoint{time: start.Add(time.Minute)}, replayed: "4,5", missed: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sub, replayed, missed := b.subscribe("svc", nil, test.since, connInfo{})
+			defer b.unsubscribe(sub)
+			if ids(replayed) != test.replayed || missed != test.missed {
+				t.Errorf("got %s missed %d, want %s missed %d", ids(replayed), missed, test.replayed, test.missed)
+			}
+		})
+	}
+}
+
+func TestParseResumePoint(t *testing.T) {
+	tests := []struct {
+		since string
+		want  resumePoint
+		err   bool
+	}{
+		{since: "", want: resumePoint{}},
+		{since: "1700000000-42", want: resumePoint{epoch: 1700000000, id: 42}},
+		{since: "2024-01-02T10:00:00Z", want: resumePoint{time: time.Date(2024, time.January, 2, 10, 0, 0, 0, time.UTC)}},
+		{since: "1700000000-x", err: true},
+		{since: "yesterday", err: true},
+	}
+	for _, test := range tests {
+		got, err := parseResumePoint(test.since)
+		if (err != nil) != test.err || !got.time.Equal(test.want.time) || got.epoch != test.want.epoch || got.id != test.want.id {
+			t.Errorf("%q: got %+v, %v - want %+v", test.since, got, err, test.want)
+		}
+	}
+}
+
+func TestForgetStream(t *testing.T) {
+	b := newBroker(10, 3)
+	sub, _, _ := b.subscribe("misspelled", nil, resumePoint{}, connInfo{})
+	b.unsubscribe(sub)
+	sub, _, _ = b.subscribe("svc", nil, resumePoint{}, connInfo{})
+	b.Publish("svc", []byte("m"), false, true)
+	b.unsubscribe(sub)
+	if _, ok := b.streams["misspelled"]; ok {
+		t.Errorf("a stream only subscribed to was kept")
+	}
+	if _, ok := b.streams["svc"]; !ok {
+		t.Errorf("a published stream was forgotten")
+	}
+}
+
+// streamLines starts an event stream of b with the Last-Event-ID lastEventID and returns its lines until
+// until returns true or a second elapses.
+func streamLines(t *testing.T, b *broker, query string, lastEventID string, until func(lines []string) bool) []string {
+	server := httptest.NewServer(http.HandlerFunc(b.HTTPHandler))
+	defer server.Close()
+	req, _ := http.NewRequest("GET", server.URL+"/events?"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	timer := time.AfterFunc(time.Second, func() { resp.Body.Close() })
+	defer timer.Stop()
+	lines := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for !until(lines) && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines
+}
+
+func TestHTTPHandlerResume(t *testing.T) {
+	b := newBroker(10, 10)
+	for i := 1; i <= 3; i++ {
+		b.Publish("svc", []byte(fmt.Sprintf("m%d", i)), false, true)
+	}
+	lines := streamLines(t, b, "stream=svc", eventID(b.epoch, 1), func(lines []string) bool { return len(lines) >= 6 })
+	want := []string{"id: " + eventID(b.epoch, 2), "data: m2", "", "id: " + eventID(b.epoch, 3), "data: m3", ""}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+
+	lines = streamLines(t, b, "stream=svc&since=0-1", "", func(lines []string) bool { return len(lines) >= 3 })
+	if want := []string{"event: " + gapEvent, `data: {"missed":-1}`, ""}; strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want the gap event of a restarted server %q", lines, want)
+	}
+}
+
+func TestHTTPHandlerFraming(t *testing.T) {
+	b := newBroker(10, 10)
+	b.keepalive = 10 * time.Millisecond
+	b.Publish("svc", []byte("a\r\nb\rc\nd"), false, true)
+	lines := streamLines(t, b, "stream=svc&since=2000-01-01T00:00:00Z", "", func(lines []string) bool {
+		return len(lines) > 0 && lines[len(lines)-1] == ":"
+	})
+	want := []string{"id: " + eventID(b.epoch, 1), "data: a", "data: b", "data: c", "data: d", "", ":"}
+	if strings.Join(lines, "|") != strings.Join(want, "|") {
+		t.Errorf("got %q, want %q", lines, want)
+	}
+}
+
+// queued drains the queue of sub and returns the data of its messages
+func queued(queue chan *message) string {
+	parts := []string{}
+	for len(queue) > 0 {
+		parts = append(parts, string((<-queue).data))
+	}
+	return strings.Join(parts, ",")
+}
+
+func TestOverflow(t *testing.T) {
+	tests := []struct {
+		policy       string
+		queued       string
+		dropped      int64
+		disconnected bool
+		control      string
+	}{
+		{policy: overflowDropOldest, queued: "m3,m4", dropped: 2, control: "r1,r2"},
+		{policy: overflowDropNewest, queued: "m1,m2", dropped: 2, control: "r1,r2"},
+		{policy: overflowDisconnect, queued: "m1,m2", dropped: 1, disconnected: true, control: "r1"},
+	}
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			b := newBroker(2, 10)
+			b.overflow = test.policy
+			sub, _, _ := b.subscribe("svc", nil, resumePoint{}, connInfo{})
+			b.Publish("svc", []byte("m1"), false, true)
+			b.Broadcast(rebalanceEvent, []byte("r1"))
+			b.Publish("svc", []byte("m2"), false, true)
+			b.Publish("svc", []byte("m3"), false, true)
+			b.Broadcast(rebalanceEvent, []byte("r2"))
+			b.Publish("svc", []byte("m4"), false, true)
+
+			select {
+			case <-sub.overflowed:
+			default:
+				t.Errorf("overflowing wasn't signaled")
+			}
+			dropped, disconnected := b.takeDropped(sub)
+			if dropped != test.dropped || disconnected != test.disconnected || sub.droppedTotal != test.dropped {
+				t.Errorf("got %d dropped(%d total), disconnected %v - want %d, %v", dropped, sub.droppedTotal, disconnected, test.dropped, test.disconnected)
+			}
+			if dropped, _ := b.takeDropped(sub); dropped != 0 {
+				t.Errorf("got %d dropped once taken, want 0", dropped)
+			}
+			if got := queued(sub.messages); got != test.queued {
+				t.Errorf("got queued %s, want %s", got, test.queued)
+			}
+			// control events are queued apart whatever the policy, until disconnected
+			if got := queued(sub.control); got != test.control {
+				t.Errorf("got control events %s, want %s", got, test.control)
+			}
+		})
+	}
+}
+
+func TestControlQueueKeepsNewest(t *testing.T) {
+	b := newBroker(1, 10)
+	sub, _, _ := b.subscribe(firehoseStream, nil, resumePoint{}, connInfo{})
+	for i := 1; i <= controlQueueSize+2; i++ {
+		b.Broadcast(rebalanceEvent, []byte(fmt.Sprint(i)))
+	}
+	if got, want := queued(sub.control), "3,4,5,6"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if dropped, _ := b.takeDropped(sub); dropped != 0 {
+		t.Errorf("got %d dropped, want control events left out", dropped)
+	}
+}
+
+// stalledWriter is a streaming response writer whose first flush waits for release, like a stalled client
+type stalledWriter struct {
+	mu      sync.Mutex
+	header  http.Header
+	body    bytes.Buffer
+	release chan struct{}
+}
+
+func (w *stalledWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *stalledWriter) WriteHeader(status int) {}
+
+func (w *stalledWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.Write(p)
+}
+
+func (w *stalledWriter) Flush() {
+	<-w.release
+}
+
+func (w *stalledWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.body.String()
+}
+
+func TestDroppedNotice(t *testing.T) {
+	b := newBroker(1, 10)
+	b.overflow = overflowDropNewest
+	w := &stalledWriter{header: http.Header{}, release: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.HTTPHandler(w, httptest.NewRequest("GET", "/events?stream=svc", nil).WithContext(ctx))
+		close(done)
+	}()
+	for subscribed := false; !subscribed; time.Sleep(time.Millisecond) {
+		subscribed = b.subscriberCounts()["svc"] == 1
+	}
+	for i := 1; i <= 4; i++ {
+		b.Publish("svc", []byte(fmt.Sprintf("m%d", i)), false, true)
+	}
+	b.Broadcast(rebalanceEvent, []byte("{}"))
+	close(w.release)
+
+	want := []string{"data: m1\n", "event: " + droppedEvent + "\ndata: {\"dropped\":3}\n", "event: " + rebalanceEvent + "\ndata: {}\n"}
+	deadline := time.Now().Add(time.Second)
+	for !containsAll(w.String(), want) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	if body := w.String(); !containsAll(body, want) || strings.Contains(body, "m2") {
+		t.Errorf("got %q, want m1, 3 messages dropped and the rebalance event", body)
+	}
+}
+
+func containsAll(s string, parts []string) bool {
+	for _, part := range parts {
+		if !strings.Contains(s, part) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package ctailserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+// fileSource reads newline delimited json messages from a file or stdin,
+// it allows running the server locally and in tests without kafka.
+type fileSource struct {
+	reader   io.ReadCloser
+	messages chan *Message
+	errors   chan error
+}
+
+// newFileSource opens path for reading, "-" reads from stdin.
+func newFileSource(path string) (*fileSource, error) {
+	reader := io.ReadCloser(os.Stdin)
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		reader = file
+	}
+	f := &fileSource{reader: reader, messages: make(chan *Message), errors: make(chan error)}
+	go f.read()
+	return f, nil
+}
+
+func (f *fileSource) read() {
+	defer close(f.messages)
+	buffered := bufio.NewReader(f.reader)
+	var offset int64
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			f.messages <- &Message{Value: line, Offset: offset, Timestamp: time.Now()}
+			offset++
+		}
+		if err != nil {
+			if err != io.EOF {
+				f.errors <- err
+			}
+			return
+		}
+	}
+}
+
+func (f *fileSource) Name() string {
+	return "file"
+}
+
+func (f *fileSource) Messages() <-chan *Message {
+	return f.messages
+}
+
+func (f *fileSource) Errors() <-chan error {
+	return f.errors
+}
+
+func (f *fileSource) Ack(msg *Message) {}
+
+func (f *fileSource) Close() error {
+	return f.reader.Close()
+}
@@ -0,0 +1,71 @@
+package ctailserver
+
+import (
+	"net/url"
+	"strings"
+)
+
+// filterParams maps the /events query parameters to the message field paths they filter on.
+var filterParams = map[string][]string{
+	"pod":     {"kubernetes", "pod_name"},
+	"podid":   {"kubernetes", "pod_id"},
+	"env":     {"kubernetes", "labels", "environment"},
+	"rev":     {"kubernetes", "labels", "version"},
+	"cluster": {"kubernetes", "labels", "kubeCluster"},
+	"level":   {"level"},
+}
+
+// typeParam filters on the message type: log or event(tagged EVENT), both are published to the service stream.
+const typeParam = "type"
+
+// condition matches when the value found at path equals one of values,
+// or when the type of the message is one of values for a type condition.
+type condition struct {
+	path     []string
+	values   []string
+	typeOnly bool
+}
+
+// filter is a list of conditions that must all match for a message to be sent to a subscriber.
+type filter []condition
+
+// parseFilter builds a filter out of the request query parameters, returns nil if no filter was requested.
+func parseFilter(query url.Values) filter {
+	var f filter
+	for param, path := range filterParams {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		f = append(f, condition{path: path, values: strings.Split(value, ",")})
+	}
+	if value := query.Get(typeParam); value != "" {
+		f = append(f, condition{values: strings.Split(value, ","), typeOnly: true})
+	}
+	return f
+}
+
+// match returns true if the message satisfies all the filter conditions.
+func (f filter) match(msg *message) bool {
+	for _, cond := range f {
+		if cond.typeOnly {
+			if !StringExists(messageType(msg.event), cond.values) {
+				return false
+			}
+			continue
+		}
+		val, ok := ExtractPath(msg.data, cond.path)
+		if !ok || !StringExists(val, cond.values) {
+			return false
+		}
+	}
+	return true
+}
+
+// messageType returns the type of a message as used by the type filter and the metrics
+func messageType(event bool) string {
+	if event {
+		return "event"
+	}
+	return "log"
+}
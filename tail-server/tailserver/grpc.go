@@ -0,0 +1,220 @@
+package ctailserver
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/sciffer/tail/tailpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcService implements the Tail gRPC API on top of the same broker and registry as the http endpoints.
+type grpcService struct {
+	tailpb.UnimplementedTailServer
+	server *ctailserver
+}
+
+func (g *grpcService) ListServices(ctx context.Context, req *tailpb.ListServicesRequest) (*tailpb.ListServicesResponse, error) {
+	res := &tailpb.ListServicesResponse{}
+	known := map[string]bool{}
+	for _, info := range g.server.registry.list(time.Now()) {
+		known[info.Name] = true
+		if !g.server.authorized(ctx, info.Name) {
+			continue
+		}
+		res.Services = append(res.Services, &tailpb.Service{
+			Name:      info.Name,
+			Owner:     info.Owner,
+			FirstSeen: timestamppb.New(info.FirstSeen),
+			LastSeen:  timestamppb.New(info.LastSeen),
+			Logs:      info.Logs,
+			Events:    info.Events,
+			Rate:      info.Rate,
+		})
+	}
+	// services only known to the peers of an aggregating server
+	for _, name := range g.server.authorizedNames(ctx, g.server.serviceNames()) {
+		if !known[name] {
+			res.Services = append(res.Services, &tailpb.Service{Name: name})
+		}
+	}
+	return res, nil
+}
+
+func (g *grpcService) Subscribe(req *tailpb.SubscribeRequest, stream tailpb.Tail_SubscribeServer) error {
+	b := g.server.broker
+	if req.Service == "" {
+		return status.Error(codes.InvalidArgument, "service is required")
+	}
+	if !g.server.authorized(stream.Context(), req.Service) {
+		return status.Error(codes.PermissionDenied, "not authorized to tail "+req.Service)
+	}
+	resume, err := parseResumePoint(req.Since)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	select {
+	case <-b.closing:
+		return status.Error(codes.Unavailable, "server is shutting down")
+	default:
+	}
+
+	f := protoFilter(req.Filter)
+	remote := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		remote = p.Addr.String()
+	}
+	sub, replayed, missed := b.subscribe(req.Service, f, resume, newConnInfo(stream.Context(), remote, "grpc"))
+	defer b.unsubscribe(sub)
+	// tells the client the subscription was accepted before any message is sent
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	if missed != 0 {
+		if err := stream.Send(&tailpb.Event{Service: req.Service, Type: tailpb.Event_GAP, Missed: missed}); err != nil {
+			return err
+		}
+	}
+	for _, msg := range replayed {
+		if f == nil || f.match(msg) {
+			if err := stream.Send(g.event(req.Service, msg)); err != nil {
+				return err
+			}
+			b.delivered(sub, msg)
+		}
+	}
+	for {
+		select {
+		case msg := <-sub.messages:
+			if err := stream.Send(g.event(req.Service, msg)); err != nil {
+				return err
+			}
+			b.delivered(sub, msg)
+		case msg := <-sub.control:
+			if err := stream.Send(g.event(req.Service, msg)); err != nil {
+				return err
+			}
+		case <-sub.overflowed:
+			dropped, disconnected := b.takeDropped(sub)
+			if err := stream.Send(&tailpb.Event{Service: req.Service, Type: tailpb.Event_DROPPED, Missed: dropped}); err != nil {
+				return err
+			}
+			if disconnected {
+				return status.Error(codes.ResourceExhausted, "subscriber too slow")
+			}
+		case <-b.closing:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (g *grpcService) GetRecent(ctx context.Context, req *tailpb.GetRecentRequest) (*tailpb.GetRecentResponse, error) {
+	if req.Service == "" {
+		return nil, status.Error(codes.InvalidArgument, "service is required")
+	}
+	if !g.server.authorized(ctx, req.Service) {
+		return nil, status.Error(codes.PermissionDenied, "not authorized to tail "+req.Service)
+	}
+	res := &tailpb.GetRecentResponse{}
+	for _, msg := range g.server.broker.recent(req.Service, protoFilter(req.Filter), int(req.Limit)) {
+		res.Events = append(res.Events, g.event(req.Service, msg))
+	}
+	return res, nil
+}
+
+// event converts a broker message of service, the owner is extracted the same way the routing does.
+func (g *grpcService) event(service string, msg *message) *tailpb.Event {
+	event := &tailpb.Event{Service: service, Payload: msg.data, Received: timestamppb.New(msg.received)}
+	if msg.name == rebalanceEvent {
+		event.Type = tailpb.Event_REBALANCE
+		return event
+	}
+	event.Id = eventID(g.server.broker.epoch, msg.id)
+	event.Owner = ExtractFirst(msg.data, g.server.ownerFields)
+	if event.Owner == "" {
+		event.Owner = "none"
+	}
+	if msg.event {
+		event.Type = tailpb.Event_EVENT
+	}
+	return event
+}
+
+// protoFilter builds a subscriber filter from the filter of a request.
+func protoFilter(f *tailpb.Filter) filter {
+	if f == nil {
+		return nil
+	}
+	query := url.Values{}
+	for param, values := range map[string][]string{
+		"pod":     f.Pods,
+		"podid":   f.PodIds,
+		"env":     f.Envs,
+		"rev":     f.Revs,
+		"cluster": f.Clusters,
+		"level":   f.Levels,
+	} {
+		if len(values) > 0 {
+			query.Set(param, strings.Join(values, ","))
+		}
+	}
+	types := []string{}
+	for _, t := range f.Types {
+		types = append(types, messageType(t == tailpb.Event_EVENT))
+	}
+	if len(types) > 0 {
+		query.Set(typeParam, strings.Join(types, ","))
+	}
+	return parseFilter(query)
+}
+
+// grpcAuthenticate adds the principal of the bearer token of the authorization metadata to ctx.
+func (s *ctailserver) grpcAuthenticate(ctx context.Context) (context.Context, error) {
+	token := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 && strings.HasPrefix(values[0], "Bearer ") {
+			token = strings.TrimSpace(values[0][len("Bearer "):])
+		}
+	}
+	p, err := s.auth.authenticate(token)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return context.WithValue(ctx, principalKey{}, p), nil
+}
+
+func (s *ctailserver) grpcUnaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.grpcAuthenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *ctailserver) grpcStreamAuth(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.grpcAuthenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
+
+// authenticatedStream carries the principal in the context of a server stream.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (a *authenticatedStream) Context() context.Context {
+	return a.ctx
+}
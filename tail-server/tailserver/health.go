@@ -0,0 +1,217 @@
+package ctailserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	cluster "github.com/bsm/sarama-cluster"
+)
+
+const (
+	// stallTimeout is how long the routing loop may go without an iteration before /healthz fails
+	stallTimeout = time.Minute
+	// errorWindow is how long a consumption error keeps a source unready unless messages flow again
+	errorWindow = 30 * time.Second
+	// heartbeatInterval is how often the routing loop reports itself alive when idle
+	heartbeatInterval = 10 * time.Second
+)
+
+// sourceHealth is the consumption state of a single source.
+type sourceHealth struct {
+	Name        string             `json:"name"`
+	State       string             `json:"state"` // connecting, rebalancing, consuming, error
+	LastMessage time.Time          `json:"last_message"`
+	LastError   string             `json:"last_error,omitempty"`
+	ErrorTime   time.Time          `json:"last_error_time"`
+	Partitions  map[string][]int32 `json:"partitions,omitempty"`
+	kafka       bool
+}
+
+// health tracks the state reported by /healthz and /readyz, it is updated by the routing loop.
+type health struct {
+	mu           sync.RWMutex
+	sources      map[Source]*sourceHealth
+	loop         time.Time
+	shuttingDown bool
+}
+
+// healthReport is the json body of /healthz and /readyz. The probes are served unauthenticated, so subscribers
+// are only counted and no service names are exposed.
+type healthReport struct {
+	Status             string         `json:"status"`
+	Reasons            []string       `json:"reasons,omitempty"`
+	ShuttingDown       bool           `json:"shutting_down"`
+	SinceLoop          float64        `json:"seconds_since_routing"`
+	Sources            []sourceReport `json:"sources"`
+	TotalSubscribers   int            `json:"total_subscribers"`
+	AssignedPartitions int            `json:"assigned_partitions"`
+}
+
+type sourceReport struct {
+	sourceHealth
+	SinceLastMessage float64 `json:"seconds_since_last_message"`
+}
+
+func newHealth() *health {
+	return &health{sources: make(map[Source]*sourceHealth), loop: time.Now()}
+}
+
+func (h *health) addSource(src Source) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, kafka := src.(*kafkaSource)
+	state := "consuming"
+	if kafka {
+		state = "connecting" // until the first partition assignment
+	}
+	h.sources[src] = &sourceHealth{Name: src.Name(), State: state, kafka: kafka}
+}
+
+func (h *health) tick(now time.Time) {
+	h.mu.Lock()
+	h.loop = now
+	h.mu.Unlock()
+}
+
+func (h *health) message(src Source, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.loop = now
+	if sh, ok := h.sources[src]; ok {
+		sh.LastMessage = now
+		if sh.State == "error" {
+			sh.State = "consuming"
+		}
+	}
+}
+
+func (h *health) failure(src Source, err error, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.loop = now
+	if sh, ok := h.sources[src]; ok {
+		sh.State = "error"
+		sh.LastError = err.Error()
+		sh.ErrorTime = now
+	}
+}
+
+func (h *health) rebalance(src Source, ntf *cluster.Notification, now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.loop = now
+	sh, ok := h.sources[src]
+	if !ok {
+		return
+	}
+	switch ntf.Type {
+	case cluster.RebalanceStart:
+		sh.State = "rebalancing"
+	case cluster.RebalanceOK:
+		sh.State = "consuming"
+		sh.Partitions = ntf.Current
+	case cluster.RebalanceError:
+		sh.State = "error"
+		sh.LastError = "rebalance failed"
+		sh.ErrorTime = now
+	}
+}
+
+// assignment returns the kafka partitions per topic currently assigned to this server.
+func (h *health) assignment() map[string][]int32 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	assignment := make(map[string][]int32)
+	for _, sh := range h.sources {
+		if sh.State != "consuming" && sh.State != "error" {
+			continue // the partitions are being reassigned
+		}
+		for topic, partitions := range sh.Partitions {
+			assignment[topic] = append(assignment[topic], partitions...)
+		}
+	}
+	return assignment
+}
+
+func (h *health) shutdown() {
+	h.mu.Lock()
+	h.shuttingDown = true
+	h.mu.Unlock()
+}
+
+// report builds the health report, live is false when the routing loop stalled and
+// ready is false when the server is not actually consuming.
+func (h *health) report(subscribers map[string]int, now time.Time) (report healthReport, live bool, ready bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	report = healthReport{
+		ShuttingDown: h.shuttingDown,
+		SinceLoop:    now.Sub(h.loop).Seconds(),
+		Sources:      []sourceReport{},
+	}
+	for _, count := range subscribers {
+		report.TotalSubscribers += count
+	}
+
+	live = now.Sub(h.loop) < stallTimeout
+	if !live {
+		report.Reasons = append(report.Reasons, "routing loop stalled")
+	}
+	ready = live && !h.shuttingDown && len(h.sources) > 0
+	if h.shuttingDown {
+		report.Reasons = append(report.Reasons, "shutting down")
+	}
+	if len(h.sources) == 0 {
+		report.Reasons = append(report.Reasons, "no sources")
+	}
+	for _, sh := range h.sources {
+		sr := sourceReport{sourceHealth: *sh}
+		if !sh.LastMessage.IsZero() {
+			sr.SinceLastMessage = now.Sub(sh.LastMessage).Seconds()
+		}
+		report.Sources = append(report.Sources, sr)
+		for _, partitions := range sh.Partitions {
+			report.AssignedPartitions += len(partitions)
+		}
+		if !sh.kafka {
+			continue
+		}
+		switch {
+		case sh.State == "error" && now.Sub(sh.ErrorTime) < errorWindow:
+			ready = false
+			report.Reasons = append(report.Reasons, sh.Name+": "+sh.LastError)
+		case sh.State == "connecting" || sh.State == "rebalancing":
+			ready = false
+			report.Reasons = append(report.Reasons, sh.Name+": "+sh.State)
+		case len(sh.Partitions) == 0:
+			ready = false
+			report.Reasons = append(report.Reasons, sh.Name+": no partitions assigned")
+		}
+	}
+	report.Status = "ok"
+	if !ready {
+		report.Status = "unavailable"
+	}
+	return report, live, ready
+}
+
+// healthHandler serves /healthz when readiness is false and /readyz when it is true.
+func (s *ctailserver) healthHandler(readiness bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		report, live, ready := s.health.report(s.broker.subscriberCounts(), time.Now())
+		if !readiness {
+			report.Status = "ok"
+			if !live {
+				report.Status = "unavailable"
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if (readiness && !ready) || (!readiness && !live) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		reportjson, _ := json.Marshal(report)
+		w.Write(reportjson)
+	}
+}
@@ -0,0 +1,20 @@
+package ctailserver
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHealthReportHidesServices(t *testing.T) {
+	h := newHealth()
+	report, _, _ := h.report(map[string]int{"secret-service": 2, firehoseStream: 1}, time.Now())
+	if report.TotalSubscribers != 3 {
+		t.Errorf("got %d subscribers, want 3", report.TotalSubscribers)
+	}
+	reportjson, _ := json.Marshal(report)
+	if strings.Contains(string(reportjson), "secret-service") {
+		t.Errorf("the unauthenticated report lists the services: %s", reportjson)
+	}
+}
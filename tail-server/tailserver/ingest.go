@@ -0,0 +1,124 @@
+package ctailserver
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// maxIngestBody is the largest body accepted by /ingest, before decompression
+	maxIngestBody = 32 << 20
+	// maxIngestLine is the longest message accepted by /ingest, after decompression
+	maxIngestLine = 1 << 20
+)
+
+// ingestSource receives newline delimited json messages posted to /ingest, it lets batch jobs
+// and CI runners without kafka credentials make their logs tailable.
+type ingestSource struct {
+	// authorize returns the service of a message and whether the caller of ctx may ingest it
+	authorize func(ctx context.Context, value []byte) (string, bool)
+	messages  chan *Message
+	errors    chan error
+	done      chan struct{}
+}
+
+func newIngestSource() *ingestSource {
+	return &ingestSource{messages: make(chan *Message), errors: make(chan error), done: make(chan struct{})}
+}
+
+// ServeHTTP reads the posted NDJSON body(optionally gzip encoded) and feeds every line to the routing.
+// Lines are published as they are read, so a body failing midway(a line too long or not allowed, the body
+// too large) was partially ingested. The response is a json object with the number of lines ingested, along
+// with the error on failure, so callers can resend the lines that follow them.
+func (i *ingestSource) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body := io.Reader(http.MaxBytesReader(w, r.Body, maxIngestBody))
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			ingestError(w, http.StatusBadRequest, 0, "Invalid gzip body: %s", err)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	// lines are streamed, so only the line being read is held in memory however much a gzip body expands
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxIngestLine)
+	ingested := 0
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			if i.authorize != nil {
+				if service, ok := i.authorize(r.Context(), line); !ok {
+					ingestError(w, http.StatusForbidden, ingested, "Not allowed to ingest messages of service %s", service)
+					return
+				}
+			}
+			select {
+			case i.messages <- &Message{Value: append([]byte(nil), line...), Timestamp: time.Now()}:
+				ingested++
+			case <-i.done:
+				ingestError(w, http.StatusServiceUnavailable, ingested, "Server is shutting down")
+				return
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		var tooLarge *http.MaxBytesError
+		if err == bufio.ErrTooLong {
+			ingestError(w, http.StatusRequestEntityTooLarge, ingested, "Message longer than %d bytes", maxIngestLine)
+		} else if errors.As(err, &tooLarge) {
+			ingestError(w, http.StatusRequestEntityTooLarge, ingested, "Body larger than %d bytes", maxIngestBody)
+		} else {
+			ingestError(w, http.StatusBadRequest, ingested, "Failed reading body: %s", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ingestResult{Ingested: ingested})
+}
+
+// ingestResult is the response of /ingest
+type ingestResult struct {
+	Ingested int    `json:"ingested"`
+	Error    string `json:"error,omitempty"`
+}
+
+// ingestError responds with status and the error formatted as fmt.Sprintf, along with the number of lines ingested
+func ingestError(w http.ResponseWriter, status int, ingested int, format string, values ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ingestResult{Ingested: ingested, Error: fmt.Sprintf(format, values...)})
+}
+
+func (i *ingestSource) Name() string {
+	return "ingest"
+}
+
+func (i *ingestSource) Messages() <-chan *Message {
+	return i.messages
+}
+
+func (i *ingestSource) Errors() <-chan error {
+	return i.errors
+}
+
+func (i *ingestSource) Ack(msg *Message) {}
+
+func (i *ingestSource) Close() error {
+	close(i.done)
+	return nil
+}
@@ -0,0 +1,64 @@
+package ctailserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIngest(t *testing.T) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	gz.Write([]byte("{\"app\":\"a\"}\n{\"app\":\"b\"}\n"))
+	gz.Close()
+	tests := []struct {
+		name     string
+		body     string
+		gzip     bool
+		status   int
+		ingested int
+		error    string
+	}{
+		{name: "ndjson", body: "{\"app\":\"a\"}\n\n  \n{\"app\":\"b\"}", status: http.StatusOK, ingested: 2},
+		{name: "gzip", body: compressed.String(), gzip: true, status: http.StatusOK, ingested: 2},
+		{name: "invalid gzip", body: "plain", gzip: true, status: http.StatusBadRequest, error: "Invalid gzip body"},
+		{name: "not allowed midway", body: "{\"app\":\"a\"}\n{\"app\":\"secret\"}\n{\"app\":\"b\"}", status: http.StatusForbidden, ingested: 1, error: "service secret"},
+		{name: "line too long midway", body: "{\"app\":\"a\"}\n" + strings.Repeat("x", maxIngestLine+1), status: http.StatusRequestEntityTooLarge, ingested: 1, error: "Message longer"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := newIngestSource()
+			src.authorize = func(ctx context.Context, value []byte) (string, bool) {
+				service, _ := ExtractPath(value, []string{"app"})
+				return service, service != "secret"
+			}
+			go func() {
+				for range src.messages {
+				}
+			}()
+			req := httptest.NewRequest("POST", "/ingest", strings.NewReader(test.body))
+			if test.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			src.ServeHTTP(w, req)
+			close(src.messages)
+
+			var result ingestResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatalf("invalid response %q: %s", w.Body.String(), err)
+			}
+			if w.Code != test.status || result.Ingested != test.ingested || !strings.Contains(result.Error, test.error) {
+				t.Errorf("got %d %+v, want %d with %d ingested and error %q", w.Code, result, test.status, test.ingested, test.error)
+			}
+			if test.error == "" && result.Error != "" {
+				t.Errorf("got error %q, want none", result.Error)
+			}
+		})
+	}
+}
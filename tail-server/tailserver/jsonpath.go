@@ -0,0 +1,193 @@
+package ctailserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// ParsePaths parses a comma separated list of dotted json paths, like: kubernetes.labels.app,app
+func ParsePaths(fields string) [][]string {
+	paths := [][]string{}
+	for _, field := range strings.Split(fields, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			paths = append(paths, strings.Split(field, "."))
+		}
+	}
+	return paths
+}
+
+// ExtractFirst returns the string value of the first path found in data, paths are tried in order.
+func ExtractFirst(data []byte, paths [][]string) string {
+	for _, path := range paths {
+		if val, ok := ExtractPath(data, path); ok && val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
+// ExtractPath returns the string value found at path in the json object data. The document is scanned
+// without being decoded, only keys of the objects along the path are compared and other values are skipped,
+// so a matching key nested elsewhere or inside a string value is never picked up.
+func ExtractPath(data []byte, path []string) (string, bool) {
+	i := locatePath(data, path)
+	if i < 0 || data[i] != '"' {
+		return "", false
+	}
+	end := skipString(data, i)
+	if end < 0 {
+		return "", false
+	}
+	return unquote(data[i:end])
+}
+
+// ExtractStrings returns the string elements of the json array found at path in data, like the message tags.
+func ExtractStrings(data []byte, path []string) []string {
+	i := locatePath(data, path)
+	if i < 0 || data[i] != '[' {
+		return nil
+	}
+	end := skipValue(data, i)
+	if end < 0 {
+		return nil
+	}
+	var elements []interface{}
+	if err := json.Unmarshal(data[i:end], &elements); err != nil {
+		return nil
+	}
+	values := []string{}
+	for _, element := range elements {
+		if value, ok := element.(string); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// locatePath returns the position of the value found at path in data, -1 if it is not found.
+func locatePath(data []byte, path []string) int {
+	i := skipSpace(data, 0)
+	for depth, key := range path {
+		if i >= len(data) || data[i] != '{' {
+			return -1
+		}
+		i++
+		found := false
+		for !found {
+			i = skipSpace(data, i)
+			if i >= len(data) || data[i] != '"' {
+				return -1 // end of object or malformed
+			}
+			keyStart := i
+			if i = skipString(data, i); i < 0 {
+				return -1
+			}
+			matched := keyEquals(data[keyStart:i], key)
+			i = skipSpace(data, i)
+			if i >= len(data) || data[i] != ':' {
+				return -1
+			}
+			i = skipSpace(data, i+1)
+			if matched {
+				found = true
+				break
+			}
+			if i = skipValue(data, i); i < 0 {
+				return -1
+			}
+			i = skipSpace(data, i)
+			if i < len(data) && data[i] == ',' {
+				i++
+			}
+		}
+		if depth == len(path)-1 {
+			if i >= len(data) {
+				return -1
+			}
+			return i
+		}
+	}
+	return -1
+}
+
+// keyEquals compares a quoted json key with key, unescaping it only when needed.
+func keyEquals(quoted []byte, key string) bool {
+	raw := quoted[1 : len(quoted)-1]
+	if bytes.IndexByte(raw, '\\') == -1 {
+		return string(raw) == key
+	}
+	unquoted, ok := unquote(quoted)
+	return ok && unquoted == key
+}
+
+func unquote(quoted []byte) (string, bool) {
+	raw := quoted[1 : len(quoted)-1]
+	if bytes.IndexByte(raw, '\\') == -1 {
+		return string(raw), true
+	}
+	var val string
+	if err := json.Unmarshal(quoted, &val); err != nil {
+		return "", false
+	}
+	return val, true
+}
+
+func skipSpace(data []byte, i int) int {
+	for i < len(data) && (data[i] == ' ' || data[i] == '\t' || data[i] == '\n' || data[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipString returns the position following the string starting at i, -1 if it is not terminated.
+func skipString(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// skipValue returns the position following the json value starting at i, -1 if it is malformed.
+func skipValue(data []byte, i int) int {
+	if i >= len(data) {
+		return -1
+	}
+	switch data[i] {
+	case '"':
+		return skipString(data, i)
+	case '{', '[':
+		depth := 0
+		for ; i < len(data); i++ {
+			switch data[i] {
+			case '"':
+				if i = skipString(data, i); i < 0 {
+					return -1
+				}
+				i--
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1
+				}
+			}
+		}
+		return -1
+	default:
+		// numbers, true, false and null
+		for ; i < len(data); i++ {
+			switch data[i] {
+			case ',', '}', ']', ' ', '\t', '\n', '\r':
+				return i
+			}
+		}
+		return i
+	}
+}
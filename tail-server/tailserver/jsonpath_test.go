@@ -0,0 +1,82 @@
+package ctailserver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExtractPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		path  string
+		value string
+		found bool
+	}{
+		{name: "top level", data: `{"app":"checkout","level":"INFO"}`, path: "app", value: "checkout", found: true},
+		{name: "nested", data: `{"kubernetes":{"labels":{"app":"payments"}}}`, path: "kubernetes.labels.app", value: "payments", found: true},
+		{name: "whitespace", data: " {\n\t\"a\" : { \"b\" :\r\n\"c\" } }", path: "a.b", value: "c", found: true},
+		{name: "skips other values", data: `{"n":1.5e3,"t":true,"z":null,"arr":[1,{"app":"no"},"]"],"obj":{"app":"no","s":"}"},"app":"yes"}`, path: "app", value: "yes", found: true},
+		{name: "key inside a string value", data: `{"message":"{\"app\":\"spoofed\"}","app":"real"}`, path: "app", value: "real", found: true},
+		{name: "key nested elsewhere", data: `{"meta":{"app":"nested"}}`, path: "app", found: false},
+		{name: "escaped key", data: `{"\u0061pp":"escaped"}`, path: "app", value: "escaped", found: true},
+		{name: "escaped value", data: `{"app":"a\"b\\cé"}`, path: "app", value: "a\"b\\cé", found: true},
+		{name: "escaped quote before the key", data: `{"x":"\\","app":"after"}`, path: "app", value: "after", found: true},
+		{name: "non string value", data: `{"app":42}`, path: "app", found: false},
+		{name: "object value", data: `{"app":{"name":"x"}}`, path: "app", found: false},
+		{name: "path through a non object", data: `{"kubernetes":"flat"}`, path: "kubernetes.labels", found: false},
+		{name: "missing", data: `{"level":"INFO"}`, path: "app", found: false},
+		{name: "empty object", data: `{}`, path: "app", found: false},
+		{name: "not an object", data: `["app","x"]`, path: "app", found: false},
+		{name: "empty document", data: ``, path: "app", found: false},
+		{name: "truncated after key", data: `{"app"`, path: "app", found: false},
+		{name: "truncated after colon", data: `{"app":`, path: "app", found: false},
+		{name: "truncated value", data: `{"app":"check`, path: "app", found: false},
+		{name: "truncated before the key", data: `{"level":{"x":"y"`, path: "app", found: false},
+		{name: "unterminated key", data: `{"ap`, path: "app", found: false},
+		{name: "missing colon", data: `{"app" "x"}`, path: "app", found: false},
+		{name: "invalid escape", data: `{"app":"\x"}`, path: "app", found: false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, found := ExtractPath([]byte(test.data), strings.Split(test.path, "."))
+			if value != test.value || found != test.found {
+				t.Errorf("got %q, %v - want %q, %v", value, found, test.value, test.found)
+			}
+		})
+	}
+}
+
+func TestExtractFirst(t *testing.T) {
+	paths := ParsePaths(" kubernetes.labels.app, ,app")
+	if len(paths) != 2 {
+		t.Fatalf("got %d paths, want 2", len(paths))
+	}
+	if got := ExtractFirst([]byte(`{"app":"flat","kubernetes":{"labels":{"app":"label"}}}`), paths); got != "label" {
+		t.Errorf("got %q, want the first path found", got)
+	}
+	if got := ExtractFirst([]byte(`{"app":"flat","kubernetes":{"labels":{"app":""}}}`), paths); got != "flat" {
+		t.Errorf("got %q, want empty values skipped", got)
+	}
+	if got := ExtractFirst([]byte(`{"level":"INFO"}`), paths); got != "" {
+		t.Errorf("got %q, want none", got)
+	}
+}
+
+func TestExtractStrings(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{data: `{"tags":["a","EVENT",1,null]}`, want: "a,EVENT"},
+		{data: `{"tags":[]}`, want: ""},
+		{data: `{"tags":"EVENT"}`, want: ""},
+		{data: `{"tags":["a","b"`, want: ""},
+		{data: `{"message":"\"tags\":[\"EVENT\"]"}`, want: ""},
+	}
+	for _, test := range tests {
+		if got := strings.Join(ExtractStrings([]byte(test.data), []string{"tags"}), ","); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.data, got, test.want)
+		}
+	}
+}
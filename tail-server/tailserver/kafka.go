@@ -0,0 +1,194 @@
+package ctailserver
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"fmt"
+	"hash"
+	"time"
+
+	"github.com/Shopify/sarama"
+	cluster "github.com/bsm/sarama-cluster"
+	"github.com/xdg/scram"
+)
+
+// offsetCommitted starts consuming from the offsets committed for the group.
+const offsetCommitted int64 = 0
+
+// kafkaSource consumes messages from a kafka topic as part of a consumer group,
+// the partitions are sharded between the ctail servers of the same group.
+type kafkaSource struct {
+	consumer *cluster.Consumer
+	client   *cluster.Client
+	messages chan *Message
+}
+
+func newKafkaSource(consumer *cluster.Consumer, client *cluster.Client) *kafkaSource {
+	k := &kafkaSource{consumer: consumer, client: client, messages: make(chan *Message)}
+	go func() {
+		defer close(k.messages)
+		for msg := range consumer.Messages() {
+			k.messages <- &Message{
+				Value:     msg.Value,
+				Topic:     msg.Topic,
+				Partition: msg.Partition,
+				Offset:    msg.Offset,
+				Timestamp: msg.Timestamp,
+			}
+		}
+	}()
+	return k
+}
+
+func (k *kafkaSource) Name() string {
+	return "kafka"
+}
+
+func (k *kafkaSource) Messages() <-chan *Message {
+	return k.messages
+}
+
+func (k *kafkaSource) Errors() <-chan error {
+	return k.consumer.Errors()
+}
+
+// Notifications returns the consumer group rebalance notifications
+func (k *kafkaSource) Notifications() <-chan *cluster.Notification {
+	return k.consumer.Notifications()
+}
+
+func (k *kafkaSource) Ack(msg *Message) {
+	k.consumer.MarkPartitionOffset(msg.Topic, msg.Partition, msg.Offset, "")
+}
+
+// Close commits the marked offsets before leaving the consumer group
+func (k *kafkaSource) Close() error {
+	err := k.consumer.CommitOffsets()
+	if closeErr := k.consumer.Close(); err == nil {
+		err = closeErr
+	}
+	if clientErr := k.client.Close(); err == nil {
+		err = clientErr
+	}
+	return err
+}
+
+// parseStartOffset parses oldest, newest, committed or an RFC3339 timestamp into the time argument
+// of an offsets lookup(sarama.OffsetOldest, sarama.OffsetNewest or milliseconds since epoch).
+func parseStartOffset(offset string) (int64, error) {
+	switch offset {
+	case "", "committed":
+		return offsetCommitted, nil
+	case "oldest":
+		return sarama.OffsetOldest, nil
+	case "newest":
+		return sarama.OffsetNewest, nil
+	}
+	ts, err := time.Parse(time.RFC3339, offset)
+	if err != nil {
+		return 0, fmt.Errorf("-offset should be `oldest`, `newest`, `committed` or an RFC3339 timestamp, got: %s", offset)
+	}
+	// the epoch and earlier would be taken for the committed, newest or oldest offsets
+	ms := ts.UnixNano() / int64(time.Millisecond)
+	if ms <= 0 {
+		return 0, fmt.Errorf("-offset timestamp should be after the epoch, got: %s", offset)
+	}
+	return ms, nil
+}
+
+// presetOffsets commits the offset found for start on every partition of topic, so the consumer group
+// starts consuming from there. Commits are only accepted while the group has no active members.
+func presetOffsets(client sarama.Client, group string, topic string, start int64) error {
+	partitions, err := client.Partitions(topic)
+	if err != nil {
+		return err
+	}
+	manager, err := sarama.NewOffsetManagerFromClient(group, client)
+	if err != nil {
+		return err
+	}
+	for _, partition := range partitions {
+		offset, err := client.GetOffset(topic, partition, start)
+		if err == nil && offset == -1 {
+			// no message after the requested time
+			offset, err = client.GetOffset(topic, partition, sarama.OffsetNewest)
+		}
+		if err != nil {
+			manager.Close()
+			return fmt.Errorf("partition %d: %s", partition, err)
+		}
+		pom, err := manager.ManagePartition(topic, partition)
+		if err != nil {
+			manager.Close()
+			return fmt.Errorf("partition %d: %s", partition, err)
+		}
+		// ResetOffset only rewinds and MarkOffset only moves forward
+		pom.ResetOffset(offset, "")
+		pom.MarkOffset(offset, "")
+		pom.Close()
+	}
+	return manager.Close()
+}
+
+// kafkaSecurity is the TLS and SASL configuration of the connections to the kafka brokers,
+// SASL is disabled when mechanism is empty.
+type kafkaSecurity struct {
+	tls       *tls.Config
+	mechanism string
+	user      string
+	password  string
+}
+
+// apply enables TLS and SASL(PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512) on conf as configured
+func (k *kafkaSecurity) apply(conf *sarama.Config) {
+	if k.tls != nil {
+		conf.Net.TLS.Enable = true
+		conf.Net.TLS.Config = k.tls
+	}
+	if k.mechanism == "" {
+		return
+	}
+	conf.Net.SASL.Enable = true
+	conf.Net.SASL.Handshake = true
+	conf.Net.SASL.Mechanism = sarama.SASLMechanism(k.mechanism)
+	conf.Net.SASL.User = k.user
+	conf.Net.SASL.Password = k.password
+	switch k.mechanism {
+	case sarama.SASLTypeSCRAMSHA256:
+		conf.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scramSHA256} }
+	case sarama.SASLTypeSCRAMSHA512:
+		conf.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return &scramClient{hash: scramSHA512} }
+	}
+	if !conf.Version.IsAtLeast(sarama.V0_10_0_0) {
+		conf.Version = sarama.V0_10_0_0 // SASL handshake
+	}
+}
+
+var (
+	scramSHA256 scram.HashGeneratorFcn = func() hash.Hash { return sha256.New() }
+	scramSHA512 scram.HashGeneratorFcn = func() hash.Hash { return sha512.New() }
+)
+
+// scramClient performs the SCRAM exchange of the SASL authentication with the brokers
+type scramClient struct {
+	hash         scram.HashGeneratorFcn
+	conversation *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(user string, password string, authzID string) error {
+	client, err := c.hash.NewClient(user, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
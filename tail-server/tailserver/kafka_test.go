@@ -0,0 +1,33 @@
+package ctailserver
+
+import (
+	"testing"
+
+	"github.com/Shopify/sarama"
+)
+
+func TestParseStartOffset(t *testing.T) {
+	tests := []struct {
+		offset string
+		want   int64
+		err    bool
+	}{
+		{offset: "", want: offsetCommitted},
+		{offset: "committed", want: offsetCommitted},
+		{offset: "oldest", want: sarama.OffsetOldest},
+		{offset: "newest", want: sarama.OffsetNewest},
+		{offset: "2024-01-02T10:00:00Z", want: 1704189600000},
+		{offset: "2024-01-02T12:00:00+02:00", want: 1704189600000},
+		{offset: "1970-01-01T00:00:00.001Z", want: 1},
+		{offset: "1970-01-01T00:00:00Z", err: true},
+		{offset: "1969-12-31T23:59:59.999Z", err: true},
+		{offset: "1960-01-01T00:00:00Z", err: true},
+		{offset: "yesterday", err: true},
+	}
+	for _, test := range tests {
+		got, err := parseStartOffset(test.offset)
+		if (err != nil) != test.err || (!test.err && got != test.want) {
+			t.Errorf("%q: got %d, %v - want %d, error %v", test.offset, got, err, test.want, test.err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package ctailserver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// firehoseStream subscribes to the messages of all the streams, it is used by aggregating proxies
+	firehoseStream = "*"
+
+	peerMinBackoff       = time.Second
+	peerMaxBackoff       = 30 * time.Second
+	peerServicesInterval = 30 * time.Second
+)
+
+// peerSource subscribes to the firehose of peer tail-servers(like the servers of a cluster or remote regions),
+// so a single aggregating server re-exposes their merged events and services to clients outside the cluster.
+// Peers should be servers consuming their own sources, messages received from peers are not forwarded further.
+type peerSource struct {
+	peers  []string
+	uri    string
+	token  string
+	client *http.Client
+	up     *prometheus.GaugeVec
+	// rebalanced is called with the assignment of the rebalance events of the peers
+	rebalanced func(data []byte)
+	messages   chan *Message
+	errors     chan error
+	ctx        context.Context
+	cancel     context.CancelFunc
+	mu         sync.RWMutex
+	services   map[string][]string // by peer
+}
+
+// newPeerSource starts following the peers with client, a peer is a <host>:<port> or an http(s) url.
+// token is sent as bearer token to peers that require authentication, rebalanced is called
+// whenever the kafka partitions moved between the peers.
+func newPeerSource(peers []string, uri string, token string, client *http.Client, up *prometheus.GaugeVec, rebalanced func(data []byte)) *peerSource {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &peerSource{
+		uri:        uri,
+		token:      token,
+		client:     client,
+		up:         up,
+		rebalanced: rebalanced,
+		messages:   make(chan *Message),
+		errors:     make(chan error, 16),
+		ctx:        ctx,
+		cancel:     cancel,
+		services:   make(map[string][]string),
+	}
+	for _, peer := range peers {
+		if peer = strings.TrimSpace(peer); peer == "" {
+			continue
+		}
+		if !strings.Contains(peer, "://") {
+			if !strings.Contains(peer, ":") {
+				peer += ":8080"
+			}
+			peer = "http://" + peer
+		}
+		peer = strings.TrimRight(peer, "/")
+		p.peers = append(p.peers, peer)
+		up.With(prometheus.Labels{"peer": peer}).Set(0)
+		go p.follow(peer)
+		go p.pollServices(peer)
+	}
+	return p
+}
+
+// peerClient returns the http client of the peers, https peers are verified with the CAs of caFile(the system
+// CAs when empty) and the certFile/keyFile client certificate is presented when provided.
+func peerClient(caFile string, certFile string, keyFile string) (*http.Client, error) {
+	config, err := clientTLSConfig(caFile, certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	return &http.Client{Transport: transport}, nil
+}
+
+// follow keeps consuming the firehose of peer, reconnecting with exponential backoff
+func (p *peerSource) follow(peer string) {
+	backoff := peerMinBackoff
+	for {
+		err := p.consume(peer, func() {
+			backoff = peerMinBackoff
+			p.up.With(prometheus.Labels{"peer": peer}).Set(1)
+		})
+		p.up.With(prometheus.Labels{"peer": peer}).Set(0)
+		if p.ctx.Err() != nil {
+			return
+		}
+		p.reportError(fmt.Errorf("peer %s: %s", peer, err))
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > peerMaxBackoff {
+			backoff = peerMaxBackoff
+		}
+	}
+}
+
+// consume reads the server-sent events of the peer firehose until it fails, control events other than
+// rebalances are skipped
+func (p *peerSource) consume(peer string, onConnect func()) error {
+	req, err := http.NewRequest("GET", peer+p.uri+"?stream="+firehoseStream, nil)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(p.ctx)
+	req.Header.Set("Accept", "text/event-stream")
+	p.authorize(req)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	onConnect()
+
+	reader := bufio.NewReader(resp.Body)
+	var name string
+	var data []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("stream closed by peer")
+			}
+			return err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if len(line) > 0 {
+			if bytes.HasPrefix(line, []byte("event:")) {
+				name = string(bytes.TrimSpace(line[len("event:"):]))
+			} else if bytes.HasPrefix(line, []byte("data:")) {
+				value := bytes.TrimPrefix(line[len("data:"):], []byte(" "))
+				if data != nil {
+					data = append(append(data, '\n'), value...)
+				} else {
+					data = append([]byte{}, value...)
+				}
+			}
+			continue
+		}
+		if name == shutdownEvent {
+			return fmt.Errorf("peer is shutting down")
+		}
+		if name == rebalanceEvent && p.rebalanced != nil {
+			p.rebalanced(data)
+		}
+		if name == "" && data != nil {
+			select {
+			case p.messages <- &Message{Value: data, Timestamp: time.Now()}:
+			case <-p.ctx.Done():
+				return p.ctx.Err()
+			}
+		}
+		name, data = "", nil
+	}
+}
+
+// pollServices keeps the services of peer up to date, including the ones idle since this server started
+func (p *peerSource) pollServices(peer string) {
+	ticker := time.NewTicker(peerServicesInterval)
+	defer ticker.Stop()
+	for {
+		req, _ := http.NewRequest("GET", peer+"/services", nil)
+		req = req.WithContext(p.ctx)
+		req.Header.Set("content-type", "application/json")
+		p.authorize(req)
+		if resp, err := p.client.Do(req); err == nil {
+			services := []string{}
+			if json.NewDecoder(resp.Body).Decode(&services) == nil {
+				p.mu.Lock()
+				p.services[peer] = services
+				p.mu.Unlock()
+			}
+			resp.Body.Close()
+		}
+		select {
+		case <-ticker.C:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// serviceNames returns the sorted services known to any of the peers
+func (p *peerSource) serviceNames() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	seen := map[string]bool{}
+	names := []string{}
+	for _, services := range p.services {
+		for _, service := range services {
+			if !seen[service] {
+				seen[service] = true
+				names = append(names, service)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *peerSource) authorize(req *http.Request) {
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+}
+
+func (p *peerSource) reportError(err error) {
+	select {
+	case p.errors <- err:
+	default:
+	}
+}
+
+func (p *peerSource) Name() string {
+	return "peer"
+}
+
+func (p *peerSource) Messages() <-chan *Message {
+	return p.messages
+}
+
+func (p *peerSource) Errors() <-chan error {
+	return p.errors
+}
+
+func (p *peerSource) Ack(msg *Message) {}
+
+func (p *peerSource) Close() error {
+	p.cancel()
+	return nil
+}
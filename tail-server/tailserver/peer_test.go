@@ -0,0 +1,122 @@
+package ctailserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// writePEM writes the PEM block of der to a file of dir and returns its path
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// clientCertificate writes a self signed client certificate and its key, and returns their paths with the certificate
+func clientCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "aggregator"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writePEM(t, dir, "client.pem", "CERTIFICATE", der), writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER), cert
+}
+
+func TestPeerOverTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "peer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile, clientCert := clientCertificate(t, dir)
+
+	peer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/services" {
+			fmt.Fprint(w, `["checkout"]`)
+			return
+		}
+		fmt.Fprint(w, "id: 1-1\ndata: {\"app\":\"checkout\"}\n\nevent: "+rebalanceEvent+"\ndata: {\"assignment\":{}}\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	peer.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.RequireAndVerifyClientCert}
+	peer.StartTLS()
+	defer peer.Close()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", peer.Certificate().Raw)
+
+	for _, files := range [][]string{{"", "", ""}, {caFile, "", ""}} {
+		client, err := peerClient(files[0], files[1], files[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp, err := client.Get(peer.URL + "/services"); err == nil {
+			resp.Body.Close()
+			t.Errorf("%v: connected without verifying the peer or presenting a client certificate", files)
+		}
+	}
+
+	client, err := peerClient(caFile, certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebalanced := make(chan []byte, 1)
+	up := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_peer_up"}, []string{"peer"})
+	p := newPeerSource([]string{peer.URL}, "/events", "", client, up, func(data []byte) { rebalanced <- data })
+	defer p.Close()
+	select {
+	case msg := <-p.Messages():
+		if string(msg.Value) != `{"app":"checkout"}` {
+			t.Errorf("got message %s", msg.Value)
+		}
+	case err := <-p.Errors():
+		t.Fatalf("peer failed: %s", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received from the peer")
+	}
+	select {
+	case data := <-rebalanced:
+		if string(data) != `{"assignment":{}}` {
+			t.Errorf("got rebalance %s", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the rebalance of the peer wasn't relayed")
+	}
+}
@@ -0,0 +1,157 @@
+package ctailserver
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// rateWindow is the time constant of the exponentially weighted message rate.
+const rateWindow = time.Minute
+
+// serviceInfo is the metadata tracked for every service found in the messages.
+type serviceInfo struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Logs      uint64    `json:"logs"`
+	Events    uint64    `json:"events"`
+	Rate      float64   `json:"rate"` // messages per second
+	// Partitions are the kafka partitions per topic the service messages were consumed from
+	Partitions map[string][]int32 `json:"partitions,omitempty"`
+}
+
+// registry keeps track of the services seen by the server, it is safe for concurrent use.
+// Services that were idle for longer than ttl are evicted, a zero ttl keeps them forever.
+type registry struct {
+	mu       sync.RWMutex
+	services map[string]*serviceInfo
+	ttl      time.Duration
+}
+
+func newRegistry(ttl time.Duration) *registry {
+	return &registry{services: make(map[string]*serviceInfo), ttl: ttl}
+}
+
+// record accounts a message of service consumed from partition of topic(empty for unpartitioned sources),
+// returns true if the service was not known before.
+func (r *registry) record(service string, owner string, etype string, topic string, partition int32, now time.Time) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, known := r.services[service]
+	if !known {
+		info = &serviceInfo{Name: service, FirstSeen: now, LastSeen: now}
+		r.services[service] = info
+	}
+	info.Rate = decayRate(info.Rate, now.Sub(info.LastSeen)) + 1/rateWindow.Seconds()
+	info.LastSeen = now
+	info.Owner = owner
+	if etype == "event" {
+		info.Events++
+	} else {
+		info.Logs++
+	}
+	if topic != "" {
+		if info.Partitions == nil {
+			info.Partitions = make(map[string][]int32)
+		}
+		info.Partitions[topic] = insertPartition(info.Partitions[topic], partition)
+	}
+	return !known
+}
+
+// owner returns the owner last seen on the messages of service, empty when unknown.
+func (r *registry) owner(service string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if info, ok := r.services[service]; ok {
+		return info.Owner
+	}
+	return ""
+}
+
+// names returns the sorted names of the known services.
+func (r *registry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.services))
+	for name := range r.services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// list returns a snapshot of the known services metadata sorted by name.
+func (r *registry) list(now time.Time) []serviceInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]serviceInfo, 0, len(r.services))
+	for _, info := range r.services {
+		snapshot := *info
+		snapshot.Rate = decayRate(info.Rate, now.Sub(info.LastSeen))
+		snapshot.Partitions = copyPartitions(info.Partitions)
+		list = append(list, snapshot)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// partitions returns the partitions per topic every partitioned service was consumed from.
+func (r *registry) partitions() map[string]map[string][]int32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	partitions := make(map[string]map[string][]int32)
+	for name, info := range r.services {
+		if len(info.Partitions) > 0 {
+			partitions[name] = copyPartitions(info.Partitions)
+		}
+	}
+	return partitions
+}
+
+// expire evicts the services that were idle for longer than the ttl and returns their names.
+func (r *registry) expire(now time.Time) []string {
+	if r.ttl <= 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expired := []string{}
+	for name, info := range r.services {
+		if now.Sub(info.LastSeen) > r.ttl {
+			delete(r.services, name)
+			expired = append(expired, name)
+		}
+	}
+	return expired
+}
+
+func decayRate(rate float64, elapsed time.Duration) float64 {
+	return rate * math.Exp(-elapsed.Seconds()/rateWindow.Seconds())
+}
+
+// insertPartition adds partition to the sorted partitions unless it is already there.
+func insertPartition(partitions []int32, partition int32) []int32 {
+	i := sort.Search(len(partitions), func(i int) bool { return partitions[i] >= partition })
+	if i < len(partitions) && partitions[i] == partition {
+		return partitions
+	}
+	partitions = append(partitions, 0)
+	copy(partitions[i+1:], partitions[i:])
+	partitions[i] = partition
+	return partitions
+}
+
+func copyPartitions(partitions map[string][]int32) map[string][]int32 {
+	if partitions == nil {
+		return nil
+	}
+	copied := make(map[string][]int32, len(partitions))
+	for topic, list := range partitions {
+		copied[topic] = append([]int32(nil), list...)
+	}
+	return copied
+}
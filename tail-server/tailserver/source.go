@@ -0,0 +1,44 @@
+package ctailserver
+
+import (
+	"time"
+
+	cluster "github.com/bsm/sarama-cluster"
+)
+
+// Message is a single log message received from a Source.
+type Message struct {
+	Value     []byte
+	Topic     string
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+	source    Source
+}
+
+// Source is a transport delivering log messages to the ctail server, the routing and metrics
+// are applied the same way to the messages of every source.
+type Source interface {
+	// Name identifies the source in logs and metrics, like: kafka, file
+	Name() string
+	// Messages returns the channel of received messages, it is closed when the source is exhausted or closed
+	Messages() <-chan *Message
+	// Errors returns the channel of consumption errors
+	Errors() <-chan error
+	// Ack marks the message as processed
+	Ack(msg *Message)
+	// Close stops the source and releases its resources
+	Close() error
+}
+
+// sourceNotification is a consumer group rebalance notification tagged with the source it came from.
+type sourceNotification struct {
+	source       Source
+	notification *cluster.Notification
+}
+
+// sourceError is a consumption error tagged with the source it came from.
+type sourceError struct {
+	source Source
+	err    error
+}
@@ -0,0 +1,91 @@
+package ctailserver
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// connInfo describes the connection of a subscriber, user is empty when authentication is disabled.
+type connInfo struct {
+	remote    string
+	user      string
+	transport string
+}
+
+// newConnInfo returns the connection info of a subscriber of transport(sse, ws or grpc) connected from remote,
+// the user is the principal ctx was authenticated as.
+func newConnInfo(ctx context.Context, remote string, transport string) connInfo {
+	info := connInfo{remote: remote, transport: transport}
+	if p, ok := ctx.Value(principalKey{}).(*principal); ok {
+		info.user = p.User
+	}
+	return info
+}
+
+// subscriberInfo is the state of a subscriber as listed by /subscribers.
+type subscriberInfo struct {
+	Remote    string              `json:"remote"`
+	User      string              `json:"user,omitempty"`
+	Transport string              `json:"transport"`
+	Service   string              `json:"service"`
+	Filter    map[string][]string `json:"filter,omitempty"` // values by dotted json path, or type
+	Connected time.Time           `json:"connected"`
+	Sent      int64               `json:"sent"`
+	Dropped   int64               `json:"dropped"`
+	Queued    int                 `json:"queued"`
+}
+
+// delivered accounts msg as sent to sub, it is called by the subscriber goroutine once msg was written.
+// Control events are not accounted.
+func (b *broker) delivered(sub *subscriber, msg *message) {
+	if msg.name != "" {
+		return
+	}
+	atomic.AddInt64(&sub.sent, 1)
+	b.sentBytes.With(prometheus.Labels{"service": sub.stream}).Add(float64(len(msg.data)))
+}
+
+// list returns the connected subscribers of all the streams, the longest connected first.
+func (b *broker) list() []subscriberInfo {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	list := []subscriberInfo{}
+	add := func(sub *subscriber) {
+		info := subscriberInfo{
+			Remote:    sub.conn.remote,
+			User:      sub.conn.user,
+			Transport: sub.conn.transport,
+			Service:   sub.stream,
+			Connected: sub.connected,
+			Sent:      atomic.LoadInt64(&sub.sent),
+			Dropped:   sub.droppedTotal,
+			Queued:    len(sub.messages),
+		}
+		if len(sub.filter) > 0 {
+			info.Filter = make(map[string][]string)
+			for _, cond := range sub.filter {
+				if cond.typeOnly {
+					info.Filter[typeParam] = cond.values
+				} else {
+					info.Filter[strings.Join(cond.path, ".")] = cond.values
+				}
+			}
+		}
+		list = append(list, info)
+	}
+	for _, st := range b.streams {
+		for sub := range st.subscribers {
+			add(sub)
+		}
+	}
+	for sub := range b.firehose {
+		add(sub)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Connected.Before(list[j].Connected) })
+	return list
+}
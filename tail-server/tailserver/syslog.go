@@ -0,0 +1,361 @@
+package ctailserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSyslogFrame is the largest syslog message accepted over tcp, connections sending larger frames are closed.
+const maxSyslogFrame = 64 * 1024
+
+// maxAcceptDelay bounds the delay between retries of a failing read or accept, like net/http does.
+const maxAcceptDelay = time.Second
+
+// syslogLevels maps syslog severities to the log levels used by the rest of the logs.
+var syslogLevels = []string{"FATAL", "FATAL", "FATAL", "ERROR", "WARN", "INFO", "INFO", "DEBUG"}
+
+// syslogSource listens for RFC 5424 and RFC 3164 syslog messages over UDP and/or TCP and converts them
+// into json messages, mapping the app-name(or tag) to the app service key and the hostname to host.
+type syslogSource struct {
+	udp      net.PacketConn
+	tcp      net.Listener
+	messages chan *Message
+	errors   chan error
+	done     chan struct{}
+}
+
+// newSyslogSource starts listening on the provided addresses, an empty address disables the protocol.
+func newSyslogSource(udpAddr string, tcpAddr string) (*syslogSource, error) {
+	s := &syslogSource{messages: make(chan *Message), errors: make(chan error, 16), done: make(chan struct{})}
+	if udpAddr != "" {
+		udp, err := net.ListenPacket("udp", udpAddr)
+		if err != nil {
+			return nil, err
+		}
+		s.udp = udp
+		go s.serveUDP()
+	}
+	if tcpAddr != "" {
+		tcp, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			if s.udp != nil {
+				s.udp.Close()
+			}
+			return nil, err
+		}
+		s.tcp = tcp
+		go s.serveTCP()
+	}
+	return s, nil
+}
+
+func (s *syslogSource) serveUDP() {
+	buf := make([]byte, 65536)
+	var delay time.Duration
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if s.closed() {
+				return
+			}
+			s.reportError(err)
+			delay = s.backoff(delay)
+			continue
+		}
+		delay = 0
+		s.publish(buf[:n], addr)
+	}
+}
+
+func (s *syslogSource) serveTCP() {
+	var delay time.Duration
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if s.closed() {
+				return
+			}
+			s.reportError(err)
+			delay = s.backoff(delay)
+			continue
+		}
+		delay = 0
+		go s.serveConn(conn)
+	}
+}
+
+// backoff sleeps after a failed read or accept so persistent errors(like EMFILE) don't spin,
+// it returns the next delay: doubling from 5ms up to maxAcceptDelay.
+func (s *syslogSource) backoff(delay time.Duration) time.Duration {
+	if delay == 0 {
+		delay = 5 * time.Millisecond
+	} else if delay *= 2; delay > maxAcceptDelay {
+		delay = maxAcceptDelay
+	}
+	select {
+	case <-time.After(delay):
+	case <-s.done:
+	}
+	return delay
+}
+
+// serveConn reads the messages of a tcp connection, both octet counting and
+// newline delimited framing(RFC 6587) are supported. Frames are bounded by maxSyslogFrame.
+func (s *syslogSource) serveConn(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		frame, err := readSyslogFrame(reader, maxSyslogFrame)
+		if len(frame) > 0 {
+			s.publish(frame, conn.RemoteAddr())
+		}
+		if err != nil {
+			if err != io.EOF {
+				s.reportError(fmt.Errorf("syslog connection from %s: %s", conn.RemoteAddr(), err))
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads the next octet counted or newline delimited frame of reader, up to max bytes long.
+// A partial newline delimited frame is returned along with the error that ended it.
+func readSyslogFrame(reader *bufio.Reader, max int) ([]byte, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if first[0] >= '0' && first[0] <= '9' {
+		// the length is the decimal digits up to a space, bounded by the number of digits of max
+		digits := len(strconv.Itoa(max))
+		length, err := ioutil.ReadAll(io.LimitReader(&delimited{reader: reader, delim: ' '}, int64(digits+1)))
+		if err != nil {
+			return nil, err
+		}
+		if len(length) == 0 || length[len(length)-1] != ' ' {
+			return nil, fmt.Errorf("invalid frame length %q", length)
+		}
+		size, err := strconv.Atoi(string(length[:len(length)-1]))
+		if err != nil || size <= 0 || size > max {
+			return nil, fmt.Errorf("invalid frame length %q, should be 1 to %d", length[:len(length)-1], max)
+		}
+		frame := make([]byte, size)
+		if _, err := io.ReadFull(reader, frame); err != nil {
+			return nil, err
+		}
+		return frame, nil
+	}
+	line, err := ioutil.ReadAll(io.LimitReader(&delimited{reader: reader, delim: '\n'}, int64(max+1)))
+	if err != nil {
+		return line, err
+	}
+	if len(line) > max {
+		return nil, fmt.Errorf("frame longer than %d bytes", max)
+	}
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		return line, io.EOF
+	}
+	return line, nil
+}
+
+// delimited reads reader up to and including the next delim, then reports io.EOF.
+// It reads a byte at a time so nothing past delim is consumed.
+type delimited struct {
+	reader *bufio.Reader
+	delim  byte
+	done   bool
+}
+
+func (d *delimited) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && !d.done {
+		c, err := d.reader.ReadByte()
+		if err != nil {
+			return n, err
+		}
+		p[n] = c
+		n++
+		d.done = c == d.delim
+	}
+	if n == 0 && d.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func (s *syslogSource) publish(frame []byte, addr net.Addr) {
+	frame = bytes.TrimRight(frame, "\r\n\x00")
+	if len(frame) == 0 {
+		return
+	}
+	jsonmsg := parseSyslog(frame, time.Now())
+	if _, ok := jsonmsg["host"]; !ok && addr != nil {
+		if host, _, err := net.SplitHostPort(addr.String()); err == nil {
+			jsonmsg["host"] = host
+		}
+	}
+	value, err := json.Marshal(jsonmsg)
+	if err != nil {
+		s.reportError(err)
+		return
+	}
+	select {
+	case s.messages <- &Message{Value: value, Timestamp: time.Now()}:
+	case <-s.done:
+	}
+}
+
+func (s *syslogSource) reportError(err error) {
+	select {
+	case s.errors <- err:
+	default:
+	}
+}
+
+func (s *syslogSource) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *syslogSource) Name() string {
+	return "syslog"
+}
+
+func (s *syslogSource) Messages() <-chan *Message {
+	return s.messages
+}
+
+func (s *syslogSource) Errors() <-chan error {
+	return s.errors
+}
+
+func (s *syslogSource) Ack(msg *Message) {}
+
+func (s *syslogSource) Close() error {
+	close(s.done)
+	if s.udp != nil {
+		s.udp.Close()
+	}
+	if s.tcp != nil {
+		s.tcp.Close()
+	}
+	return nil
+}
+
+// parseSyslog parses an RFC 5424 or RFC 3164 message into the json shape the routing expects,
+// messages that can't be parsed are kept whole in the message field.
+func parseSyslog(frame []byte, received time.Time) map[string]interface{} {
+	jsonmsg := map[string]interface{}{"@timestamp": received.UTC().Format(time.RFC3339Nano), "tags": []string{"syslog"}}
+	line := string(frame)
+	if !strings.HasPrefix(line, "<") {
+		jsonmsg["message"] = line
+		return jsonmsg
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		jsonmsg["message"] = line
+		return jsonmsg
+	}
+	pri, err := strconv.Atoi(line[1:end])
+	if err != nil || pri > 191 {
+		jsonmsg["message"] = line
+		return jsonmsg
+	}
+	jsonmsg["facility"] = pri / 8
+	jsonmsg["level"] = syslogLevels[pri%8]
+	line = line[end+1:]
+
+	if len(line) > 2 && line[0] >= '1' && line[0] <= '9' && line[1] == ' ' {
+		parseRFC5424(line[2:], jsonmsg)
+	} else {
+		parseRFC3164(line, received, jsonmsg)
+	}
+	return jsonmsg
+}
+
+// parseRFC5424 parses: TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(line string, jsonmsg map[string]interface{}) {
+	fields := strings.SplitN(line, " ", 6)
+	if len(fields) < 6 {
+		jsonmsg["message"] = line
+		return
+	}
+	if ts, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		jsonmsg["@timestamp"] = ts.UTC().Format(time.RFC3339Nano)
+	}
+	for i, key := range []string{"", "host", "app", "procid", "msgid"} {
+		if key != "" && fields[i] != "-" {
+			jsonmsg[key] = fields[i]
+		}
+	}
+	rest := fields[5]
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		// structured data elements, ']' may be escaped inside param values
+		i := 0
+		for i < len(rest) && rest[i] == '[' {
+			for i++; i < len(rest) && rest[i] != ']'; i++ {
+				if rest[i] == '\\' {
+					i++
+				}
+			}
+			i++
+		}
+		if i > len(rest) {
+			i = len(rest)
+		}
+		if i > 0 {
+			jsonmsg["structured_data"] = rest[:i]
+		}
+		rest = rest[i:]
+	}
+	rest = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	jsonmsg["message"] = rest
+}
+
+// parseRFC3164 parses: Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+func parseRFC3164(line string, received time.Time, jsonmsg map[string]interface{}) {
+	if len(line) > len(time.Stamp) {
+		if ts, err := time.ParseInLocation(time.Stamp, line[:len(time.Stamp)], time.Local); err == nil {
+			ts = ts.AddDate(received.Year(), 0, 0)
+			// messages from the last days of december received in january
+			if ts.After(received.Add(24 * time.Hour)) {
+				ts = ts.AddDate(-1, 0, 0)
+			}
+			jsonmsg["@timestamp"] = ts.UTC().Format(time.RFC3339Nano)
+			line = strings.TrimPrefix(line[len(time.Stamp):], " ")
+			if space := strings.IndexByte(line, ' '); space > 0 {
+				jsonmsg["host"] = line[:space]
+				line = line[space+1:]
+			}
+		}
+	}
+	// TAG is alphanumeric, terminated by '[' or ':'. Untagged messages are left to the default service,
+	// so their first word doesn't show up as a service.
+	tagEnd := strings.IndexAny(line, "[: ")
+	if tagEnd > 0 && tagEnd <= 48 && line[tagEnd] != ' ' {
+		jsonmsg["app"] = line[:tagEnd]
+		rest := line[tagEnd:]
+		if strings.HasPrefix(rest, "[") {
+			if closing := strings.IndexByte(rest, ']'); closing > 0 {
+				jsonmsg["procid"] = rest[1:closing]
+				rest = rest[closing+1:]
+			}
+		}
+		line = strings.TrimPrefix(strings.TrimPrefix(rest, ":"), " ")
+	}
+	jsonmsg["message"] = line
+}
@@ -0,0 +1,140 @@
+package ctailserver
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSyslog(t *testing.T) {
+	received := time.Date(2024, time.January, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		frame string
+		want  map[string]interface{}
+	}{
+		{
+			name:  "rfc5424",
+			frame: `<165>1 2024-01-02T09:59:58.5Z host1 checkout 42 ID47 - payment accepted`,
+			want:  map[string]interface{}{"@timestamp": "2024-01-02T09:59:58.5Z", "facility": 20, "level": "INFO", "host": "host1", "app": "checkout", "procid": "42", "msgid": "ID47", "message": "payment accepted"},
+		},
+		{
+			name:  "rfc5424 nil values",
+			frame: `<11>1 - - - - - - boom`,
+			want:  map[string]interface{}{"@timestamp": "2024-01-02T10:00:00Z", "facility": 1, "level": "ERROR", "message": "boom"},
+		},
+		{
+			name:  "rfc5424 structured data with escaped bracket",
+			frame: `<14>1 2024-01-02T09:59:58Z h app - - [ex@1 a="x\]y"][ex@2 b="z"] text`,
+			want:  map[string]interface{}{"@timestamp": "2024-01-02T09:59:58Z", "facility": 1, "level": "INFO", "host": "h", "app": "app", "structured_data": `[ex@1 a="x\]y"][ex@2 b="z"]`, "message": "text"},
+		},
+		{
+			name:  "rfc5424 unterminated structured data",
+			frame: `<14>1 2024-01-02T09:59:58Z h app - - [ex@1 a="x`,
+			want:  map[string]interface{}{"@timestamp": "2024-01-02T09:59:58Z", "facility": 1, "level": "INFO", "host": "h", "app": "app", "structured_data": `[ex@1 a="x`, "message": ""},
+		},
+		{
+			name:  "rfc5424 truncated header",
+			frame: `<14>1 2024-01-02T09:59:58Z h app`,
+			want:  map[string]interface{}{"@timestamp": "2024-01-02T10:00:00Z", "facility": 1, "level": "INFO", "message": "2024-01-02T09:59:58Z h app"},
+		},
+		{
+			name:  "rfc3164 with pid",
+			frame: `<34>Jan  2 09:59:58 host2 sshd[123]: login failed`,
+			want:  map[string]interface{}{"@timestamp": time.Date(2024, time.January, 2, 9, 59, 58, 0, time.Local).UTC().Format(time.RFC3339Nano), "facility": 4, "level": "FATAL", "host": "host2", "app": "sshd", "procid": "123", "message": "login failed"},
+		},
+		{
+			name:  "rfc3164 december message received in january",
+			frame: `<12>Dec 31 23:59:59 host3 cron: tick`,
+			want:  map[string]interface{}{"@timestamp": time.Date(2023, time.December, 31, 23, 59, 59, 0, time.Local).UTC().Format(time.RFC3339Nano), "facility": 1, "level": "WARN", "host": "host3", "app": "cron", "message": "tick"},
+		},
+		{
+			name:  "rfc3164 untagged",
+			frame: `<13>Jan  2 09:59:58 host4 connection reset by peer`,
+			want:  map[string]interface{}{"@timestamp": time.Date(2024, time.January, 2, 9, 59, 58, 0, time.Local).UTC().Format(time.RFC3339Nano), "facility": 1, "level": "INFO", "host": "host4", "message": "connection reset by peer"},
+		},
+		{
+			name:  "rfc3164 tag without a space after the colon",
+			frame: `<13>Jan  2 09:59:58 host4 app:text`,
+			want:  map[string]interface{}{"@timestamp": time.Date(2024, time.January, 2, 9, 59, 58, 0, time.Local).UTC().Format(time.RFC3339Nano), "facility": 1, "level": "INFO", "host": "host4", "app": "app", "message": "text"},
+		},
+		{
+			name:  "no priority",
+			frame: `plain text`,
+			want:  map[string]interface{}{"@timestamp": "2024-01-02T10:00:00Z", "message": "plain text"},
+		},
+		{
+			name:  "priority out of range",
+			frame: `<192>1 - - - - - - x`,
+			want:  map[string]interface{}{"@timestamp": "2024-01-02T10:00:00Z", "message": "<192>1 - - - - - - x"},
+		},
+		{
+			name:  "unterminated priority",
+			frame: `<13`,
+			want:  map[string]interface{}{"@timestamp": "2024-01-02T10:00:00Z", "message": "<13"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := parseSyslog([]byte(test.frame), received)
+			delete(got, "tags")
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			for key, value := range test.want {
+				if got[key] != value {
+					t.Errorf("%s: got %#v, want %#v", key, got[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestReadSyslogFrame(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		frames []string
+		err    string
+	}{
+		{name: "octet counting", input: "5 <13>a3 <1>", frames: []string{"<13>a", "<1>"}},
+		{name: "newline delimited", input: "<13>a\n<13>b\n", frames: []string{"<13>a\n", "<13>b\n"}},
+		{name: "mixed", input: "3 abc<13>b\n", frames: []string{"abc", "<13>b\n"}},
+		{name: "partial last line", input: "<13>a\n<13>b", frames: []string{"<13>a\n", "<13>b"}},
+		{name: "huge length", input: "99999999999999999 <13>x\n", err: "invalid frame length"},
+		{name: "length over max", input: "65 <13>x\n", err: "should be 1 to 64"},
+		{name: "zero length", input: "0 <13>x\n", err: "should be 1 to 64"},
+		{name: "length without space", input: "12345678", err: "invalid frame length"},
+		{name: "truncated frame", input: "10 <13>x", err: "unexpected EOF"},
+		{name: "line over max", input: strings.Repeat("x", 65) + "\n", err: "longer than 64"},
+		{name: "line of max", input: strings.Repeat("x", 63) + "\n", frames: []string{strings.Repeat("x", 63) + "\n"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(test.input))
+			frames := []string{}
+			var err error
+			for {
+				var frame []byte
+				frame, err = readSyslogFrame(reader, 64)
+				if len(frame) > 0 {
+					frames = append(frames, string(frame))
+				}
+				if err != nil {
+					break
+				}
+			}
+			if test.err == "" {
+				if err.Error() != "EOF" {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			} else if !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("got error %q, want %q", err, test.err)
+			}
+			if strings.Join(frames, "|") != strings.Join(test.frames, "|") {
+				t.Errorf("got frames %q, want %q", frames, test.frames)
+			}
+		})
+	}
+}
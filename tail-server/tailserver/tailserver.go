@@ -2,129 +2,518 @@ package ctailserver
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings" //"github.com/Shopify/sarama"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Shopify/sarama"
 	cluster "github.com/bsm/sarama-cluster"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"github.com/sciffer/sse"
+	"github.com/sciffer/tail/tailpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
+// defaultCapabilities lists the optional features supported by every server, tail-clients query them via /capabilities.
+var defaultCapabilities = []string{"filter", "replay", "routing", "ws"}
+
 type ctailserver struct {
 	ingested, errors prometheus.CounterVec
 	logger           log.Logger
-	server           sse.Server
+	broker           *broker
 	mux              http.ServeMux
-	services         []string
+	httpServer       *http.Server
+	grpcServer       *grpc.Server
+	registry         *registry
+	auth             *auth
+	tlsConfig        *tls.Config
+	kafka            kafkaSecurity
+	health           *health
 	verbose          bool
 	bufferSize       int
-	consumer         cluster.Consumer
+	sources          []Source
+	peers            *peerSource
+	routeFields      [][]string
+	ownerFields      [][]string
+	capabilities     []string // the default ones and grpc once StartGRPC was called
 }
 
 func (s *ctailserver) StartHTTP(uri string, listen string) {
-	s.mux.HandleFunc(uri, s.server.HTTPHandler)
+	s.mux.Handle(uri, s.authenticatedStream(http.HandlerFunc(s.broker.HTTPHandler)))
+	s.mux.Handle("/ws", s.authenticatedStream(http.HandlerFunc(s.broker.WSHandler)))
 	s.mux.HandleFunc("/test", func(w http.ResponseWriter, _ *http.Request) { fmt.Fprintf(w, "OK") })
-	s.mux.HandleFunc("/services", func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get("content-type") == "application/json" {
-			servicesjson, _ := json.Marshal(s.services)
-			fmt.Fprintf(w, string(servicesjson))
+	s.mux.HandleFunc("/healthz", s.healthHandler(false))
+	s.mux.HandleFunc("/readyz", s.healthHandler(true))
+	// the capabilities are final once serving, StartGRPC is called before StartHTTP
+	capabilitiesjson, _ := json.Marshal(s.capabilities)
+	s.mux.HandleFunc("/capabilities", func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(capabilitiesjson)
+	})
+	s.mux.Handle("/routing", s.authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// partitions assigned to this server and the partitions every service was seen on,
+		// tail-clients combine them across servers to only subscribe to the servers carrying a service
+		routing := struct {
+			Assignment map[string][]int32            `json:"assignment"`
+			Services   map[string]map[string][]int32 `json:"services"`
+		}{s.health.assignment(), s.registry.partitions()}
+		for service := range routing.Services {
+			if !s.authorized(r.Context(), service) {
+				delete(routing.Services, service)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		routingjson, _ := json.Marshal(routing)
+		w.Write(routingjson)
+	})))
+	// only the services the caller may tail are listed
+	s.mux.Handle("/services", s.authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("details") == "true" {
+			// services metadata: owner, first/last seen, message counts and rate
+			services := []serviceInfo{}
+			for _, info := range s.registry.list(time.Now()) {
+				if s.authorized(r.Context(), info.Name) {
+					services = append(services, info)
+				}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			servicesjson, _ := json.Marshal(services)
+			w.Write(servicesjson)
+		} else if r.Header.Get("content-type") == "application/json" {
+			servicesjson, _ := json.Marshal(s.authorizedNames(r.Context(), s.serviceNames()))
+			w.Write(servicesjson)
 		} else {
-			fmt.Fprintf(w, strings.Join(s.services, "\n"))
+			fmt.Fprint(w, strings.Join(s.authorizedNames(r.Context(), s.serviceNames()), "\n"))
 		}
-	})
-	s.mux.Handle("/metrics", promhttp.Handler())
-	go http.ListenAndServe(listen, &s.mux)
+	})))
+	// the connected subscribers of the services the caller may tail: remote address, user, filter and counters
+	s.mux.Handle("/subscribers", s.authenticated(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subscribers := []subscriberInfo{}
+		for _, info := range s.broker.list() {
+			if s.authorized(r.Context(), info.Service) {
+				subscribers = append(subscribers, info)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		subscribersjson, _ := json.Marshal(subscribers)
+		w.Write(subscribersjson)
+	})))
+	s.mux.Handle("/metrics", s.authenticated(promhttp.Handler()))
+	s.httpServer = &http.Server{Addr: listen, Handler: &s.mux, TLSConfig: s.tlsConfig}
+	go func() {
+		var err error
+		if s.tlsConfig != nil {
+			err = s.httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = s.httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			s.logger.Fatalf("Listener failed: %s", err)
+		}
+	}()
 	s.logger.Println("Listener started")
 }
 
-func (s *ctailserver) InitConsumer(brokerList string, topic string, group string) {
+// StartGRPC serves the Tail gRPC API(see tailpb/tail.proto) on listen, alongside the http endpoints.
+// It should be called before StartHTTP, so /capabilities advertises grpc.
+func (s *ctailserver) StartGRPC(listen string) {
+	listener, err := net.Listen("tcp", listen)
+	if err != nil {
+		s.logger.Fatalf("Failed to open gRPC listener: %s", err)
+		printErrorAndExit(69, "Failed to open gRPC listener: %s", err)
+	}
+	options := []grpc.ServerOption{}
+	if s.tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	if s.auth != nil {
+		options = append(options, grpc.UnaryInterceptor(s.grpcUnaryAuth), grpc.StreamInterceptor(s.grpcStreamAuth))
+	}
+	s.grpcServer = grpc.NewServer(options...)
+	tailpb.RegisterTailServer(s.grpcServer, &grpcService{server: s})
+	if !StringExists("grpc", s.capabilities) {
+		s.capabilities = append(s.capabilities, "grpc")
+	}
+	go func() {
+		if err := s.grpcServer.Serve(listener); err != nil {
+			s.logger.Fatalf("gRPC listener failed: %s", err)
+		}
+	}()
+	s.logger.Println("gRPC listener started")
+}
+
+// SetOverflow sets what happens when the queue of a subscriber too slow to keep up is full: drop-oldest drops the
+// oldest queued message, drop-newest the new message and disconnect ends the subscription, so the subscriber
+// resumes from the replay buffer once reconnected. Subscribers are told about dropped messages in-band.
+func (s *ctailserver) SetOverflow(policy string) {
+	if policy != overflowDropOldest && policy != overflowDropNewest && policy != overflowDisconnect {
+		printErrorAndExit(64, "Overflow policy should be `drop-oldest`, `drop-newest` or `disconnect`")
+	}
+	s.broker.overflow = policy
+}
+
+// SetAuth requires a bearer token on the streaming, services and metrics endpoints, either a static token of tokenFile
+// or a JWT signed with the secret of jwtSecretFile, and limits the services each caller may tail to the rules of rulesFile.
+// Authentication stays disabled when no tokens or secret are provided.
+func (s *ctailserver) SetAuth(tokenFile string, jwtSecretFile string, rulesFile string) {
+	if tokenFile == "" && jwtSecretFile == "" {
+		if rulesFile != "" {
+			printErrorAndExit(64, "Authorization rules require a token file or a JWT secret")
+		}
+		return
+	}
+	a, err := loadAuth(tokenFile, jwtSecretFile, rulesFile)
+	if err != nil {
+		s.logger.Fatalf("Failed to load authentication: %s", err)
+		printErrorAndExit(78, "Failed to load authentication: %s", err)
+	}
+	s.auth = a
+	s.broker.authorize = s.authorized
+}
+
+// SetTLS serves the http and gRPC listeners over TLS with the certFile/keyFile key pair, clients must present
+// a certificate signed by one of the CAs of clientCAFile when it is provided. TLS stays disabled without a key pair.
+func (s *ctailserver) SetTLS(certFile string, keyFile string, clientCAFile string) {
+	if certFile == "" && keyFile == "" {
+		if clientCAFile != "" {
+			printErrorAndExit(64, "Client certificate verification requires a TLS certificate and key")
+		}
+		return
+	}
+	if certFile == "" || keyFile == "" {
+		printErrorAndExit(64, "TLS requires both a certificate and a key")
+	}
+	config, err := serverTLSConfig(certFile, keyFile, clientCAFile)
+	if err != nil {
+		s.logger.Fatalf("Failed to load TLS configuration: %s", err)
+		printErrorAndExit(78, "Failed to load TLS configuration: %s", err)
+	}
+	s.tlsConfig = config
+}
+
+// SetKafkaTLS connects to the kafka brokers over TLS, brokers are verified with the CAs of caFile(the system CAs
+// when empty) and the certFile/keyFile client certificate is presented when provided. Call it before InitConsumer.
+func (s *ctailserver) SetKafkaTLS(caFile string, certFile string, keyFile string) {
+	if (certFile == "") != (keyFile == "") {
+		printErrorAndExit(64, "Kafka client certificate requires both a certificate and a key")
+	}
+	config, err := clientTLSConfig(caFile, certFile, keyFile)
+	if err != nil {
+		s.logger.Fatalf("Failed to load kafka TLS configuration: %s", err)
+		printErrorAndExit(78, "Failed to load kafka TLS configuration: %s", err)
+	}
+	s.kafka.tls = config
+}
+
+// SetKafkaSASL authenticates to the kafka brokers as user with the password of passwordFile, mechanism is one of
+// PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512. Use it along with SetKafkaTLS, PLAIN sends the password as is.
+func (s *ctailserver) SetKafkaSASL(mechanism string, user string, passwordFile string) {
+	if mechanism != sarama.SASLTypePlaintext && mechanism != sarama.SASLTypeSCRAMSHA256 && mechanism != sarama.SASLTypeSCRAMSHA512 {
+		printErrorAndExit(64, "SASL mechanism should be `PLAIN`, `SCRAM-SHA-256` or `SCRAM-SHA-512`")
+	}
+	if user == "" || passwordFile == "" {
+		printErrorAndExit(64, "SASL authentication requires a user and a password file")
+	}
+	content, err := ioutil.ReadFile(passwordFile)
+	if err != nil {
+		s.logger.Fatalf("Failed to read kafka password: %s", err)
+		printErrorAndExit(66, "Failed to read kafka password: %s", err)
+	}
+	s.kafka.mechanism = mechanism
+	s.kafka.user = user
+	s.kafka.password = strings.TrimSpace(string(content))
+}
+
+// InitConsumer adds a kafka consumer group source, offset is one of oldest, newest, committed or an RFC3339 timestamp
+// to replay the topic from. Anything but committed overrides the offsets committed for the group.
+func (s *ctailserver) InitConsumer(brokerList string, topic string, group string, offset string) {
 	if s.verbose {
 		//sarama.Logger = logger - To be replaced with sarma-cluster logger
 	}
 	conf := cluster.NewConfig()
-	/*switch *offset {
-	case "oldest":
+	conf.Consumer.Return.Errors = true
+	conf.Group.Return.Notifications = true
+	start, err := parseStartOffset(offset)
+	if err != nil {
+		s.logger.Fatalf("Invalid offset: %s", err)
+		printErrorAndExit(64, "Invalid offset: %s", err)
+	}
+	if start == sarama.OffsetOldest {
 		conf.Consumer.Offsets.Initial = sarama.OffsetOldest
-	case "newest":
-		conf.Consumer.Offsets.Initial = sarama.OffsetNewest
-	default:
-		printUsageErrorAndExit("-offset should be `oldest` or `newest`")
-	}*/
+	}
+	if start > 0 {
+		conf.Version = sarama.V0_10_1_0 // offsets for times lookup
+	}
+	s.kafka.apply(&conf.Config)
+
+	client, err := cluster.NewClient(strings.Split(brokerList, ","), conf)
+	if err != nil {
+		s.logger.Fatalf("Failed to open client: %s", err)
+		printErrorAndExit(69, "Failed to open client: %s", err)
+	}
+	if start != offsetCommitted {
+		if err := presetOffsets(client.Client, group, topic, start); err != nil {
+			s.logger.Fatalf("Failed to set start offsets: %s", err)
+			printErrorAndExit(69, "Failed to set start offsets: %s", err)
+		}
+		s.logger.Printf("Start offsets of topic '%s' set to '%s' for group '%s'", topic, offset, group)
+	}
 
-	consumer, err := cluster.NewConsumer(strings.Split(brokerList, ","), group, []string{topic}, conf)
+	consumer, err := cluster.NewConsumerFromClient(client, group, []string{topic})
 	if err != nil {
 		s.logger.Fatalf("Failed to open consumer: %s", err)
 		printErrorAndExit(69, "Failed to open consumer: %s", err)
 	}
-	s.consumer = *consumer
+	s.AddSource(newKafkaSource(consumer, client))
 }
 
-func (s *ctailserver) StartConsuming() {
-	defer s.consumer.Close()
+// SetRouting sets the comma separated dotted json paths of the service and owner keys, the first path found is used
+func (s *ctailserver) SetRouting(routeFields string, ownerFields string) {
+	s.routeFields = ParsePaths(routeFields)
+	s.ownerFields = ParsePaths(ownerFields)
+}
+
+// AddSource registers a message source, its messages are routed once StartConsuming is called
+func (s *ctailserver) AddSource(src Source) {
+	s.sources = append(s.sources, src)
+	s.health.addSource(src)
+	s.errors.With(prometheus.Labels{"error": src.Name() + "_consumption"}).Add(0)
+}
+
+// InitFileSource adds a source reading newline delimited json messages from path, "-" reads stdin
+func (s *ctailserver) InitFileSource(path string) {
+	src, err := newFileSource(path)
+	if err != nil {
+		s.logger.Fatalf("Failed to open file source: %s", err)
+		printErrorAndExit(66, "Failed to open file source: %s", err)
+	}
+	s.AddSource(src)
+}
+
+// InitSyslog adds a source listening for syslog messages on the provided udp and tcp addresses, empty disables the protocol
+func (s *ctailserver) InitSyslog(udpAddr string, tcpAddr string) {
+	src, err := newSyslogSource(udpAddr, tcpAddr)
+	if err != nil {
+		s.logger.Fatalf("Failed to open syslog listener: %s", err)
+		printErrorAndExit(69, "Failed to open syslog listener: %s", err)
+	}
+	s.AddSource(src)
+}
+
+// InitIngest adds a source fed by NDJSON messages posted to the /ingest endpoint, callers may only
+// ingest messages of the services they may tail
+func (s *ctailserver) InitIngest() {
+	src := newIngestSource()
+	src.authorize = s.mayIngest
+	s.mux.Handle("/ingest", s.authenticated(src))
+	s.AddSource(src)
+}
+
+// InitPeers adds a source following the comma separated peer tail-servers(<host>:<port> or urls) on their uri,
+// so their events and services are aggregated by this server. The token of tokenFile is used to authenticate to the peers,
+// https peers are verified with the CAs of caFile(the system CAs when empty) and the certFile/keyFile client certificate
+// is presented when provided.
+func (s *ctailserver) InitPeers(peers string, uri string, tokenFile string, caFile string, certFile string, keyFile string) {
+	if (certFile == "") != (keyFile == "") {
+		printErrorAndExit(64, "Peer client certificate requires both a certificate and a key")
+	}
+	client, err := peerClient(caFile, certFile, keyFile)
+	if err != nil {
+		s.logger.Fatalf("Failed to load peer TLS configuration: %s", err)
+		printErrorAndExit(78, "Failed to load peer TLS configuration: %s", err)
+	}
+	token := ""
+	if tokenFile != "" {
+		content, err := ioutil.ReadFile(tokenFile)
+		if err != nil {
+			s.logger.Fatalf("Failed to read peer token: %s", err)
+			printErrorAndExit(66, "Failed to read peer token: %s", err)
+		}
+		token = strings.TrimSpace(string(content))
+	}
+	peerUp := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ctail_peer_up",
+		Help: "Whether the event stream of the peer ctail server is connected(1) or not(0).",
+	},
+		[]string{"peer"})
+	prometheus.MustRegister(peerUp)
+	// the subscribers of this server re-route as well when the partitions moved between the peers
+	s.peers = newPeerSource(strings.Split(peers, ","), uri, token, client, peerUp, func(data []byte) {
+		s.broker.Broadcast(rebalanceEvent, data)
+	})
+	s.AddSource(s.peers)
+}
+
+// serviceNames returns the services seen by this server merged with the ones known to its peers
+func (s *ctailserver) serviceNames() []string {
+	names := s.registry.names()
+	if s.peers == nil {
+		return names
+	}
+	for _, name := range s.peers.serviceNames() {
+		if !StringExists(name, names) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StartConsuming routes the messages of all the sources until SIGTERM/SIGINT is received,
+// then shuts the server down gracefully within shutdownTimeout.
+func (s *ctailserver) StartConsuming(shutdownTimeout time.Duration) {
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, os.Kill, os.Interrupt)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
 
 	s.logger.Println("Starting consumers and queue processing...")
 
-	service := ""
-	owner := ""
-	etype := "event"
+	// Fan in all the sources, so routing happens on a single goroutine
+	messages := make(chan *Message, s.bufferSize)
+	errs := make(chan sourceError)
+	notifications := make(chan sourceNotification)
+	for _, src := range s.sources {
+		go func(src Source) {
+			for msg := range src.Messages() {
+				msg.source = src
+				messages <- msg
+			}
+			s.logger.Printf("Source %s is exhausted", src.Name())
+		}(src)
+		go func(src Source) {
+			for err := range src.Errors() {
+				errs <- sourceError{source: src, err: err}
+			}
+		}(src)
+		if r, ok := src.(*kafkaSource); ok {
+			go func() {
+				for ntf := range r.Notifications() {
+					notifications <- sourceNotification{source: r, notification: ntf}
+				}
+			}()
+		}
+	}
+
+	expiry := time.NewTicker(time.Minute)
+	defer expiry.Stop()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
 	for {
 		select {
-		case msg, more := <-s.consumer.Messages():
-			if more {
-				service = ExtractString("app", msg.Value)
-				owner = ExtractString("owner", msg.Value)
-				if owner == "" {
-					owner = ExtractString("obowner", msg.Value)
-					if owner == "" {
-						owner = "none"
-					}
+		case now := <-heartbeat.C:
+			s.health.tick(now)
+		case now := <-expiry.C:
+			for _, service := range s.registry.expire(now) {
+				s.broker.removeStream(service)
+				if s.verbose {
+					s.logger.Printf("Expired idle service '%s'", service)
 				}
-				if service != "" {
-					s.server.Publish(service, msg.Value)
-					if !StringExists(service, s.services) {
-						s.services = append(s.services, service)
-						if s.verbose {
-							s.logger.Printf("Registered new service '%s' found in message: '%s'", service, msg.Value)
-						}
-					}
-					etype = "event"
-					if LocateString("EVENT", msg.Value) == -1 {
-						etype = "log"
-					}
-					s.ingested.With(prometheus.Labels{"service": service, "owner": owner, "type": etype}).Inc()
-				} else {
-					s.server.Publish("none", msg.Value)
-					s.ingested.With(prometheus.Labels{"service": "none", "owner": owner, "type": etype}).Inc()
-				}
-				s.consumer.MarkOffset(msg, "") // mark message as processed
-			}
-		case err, more := <-s.consumer.Errors():
-			if more {
-				s.logger.Printf("Error: %s\n", err.Error())
-				s.errors.With(prometheus.Labels{"error": "kafka_consumption"}).Inc()
 			}
-		case ntf, more := <-s.consumer.Notifications():
-			if more {
-				s.logger.Printf("Rebalanced: %+v\n", ntf)
-				s.errors.With(prometheus.Labels{"error": "kafka_rebalance"}).Inc()
+		case msg := <-messages:
+			s.route(msg)
+			msg.source.Ack(msg) // mark message as processed
+			s.health.message(msg.source, time.Now())
+		case err := <-errs:
+			s.logger.Printf("Error: %s\n", err.err.Error())
+			s.errors.With(prometheus.Labels{"error": err.source.Name() + "_consumption"}).Inc()
+			s.health.failure(err.source, err.err, time.Now())
+		case ntf := <-notifications:
+			s.logger.Printf("Rebalanced: %+v\n", ntf.notification)
+			s.errors.With(prometheus.Labels{"error": "kafka_rebalance"}).Inc()
+			s.health.rebalance(ntf.source, ntf.notification, time.Now())
+			if ntf.notification.Type == cluster.RebalanceOK {
+				assignmentjson, _ := json.Marshal(s.health.assignment())
+				s.broker.Broadcast(rebalanceEvent, assignmentjson)
 			}
 		case <-signals:
 			s.logger.Println("Done consuming")
+			ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			s.Shutdown(ctx)
 			return
 		}
 	}
 }
 
-func NewCtailServer(verbose bool, bufferSize int) ctailserver {
+// Shutdown stops accepting new subscribers, sends the connected ones a final shutdown event so they fail over,
+// drains the http listener, then commits the processed offsets and closes the sources, all within the ctx deadline.
+func (s *ctailserver) Shutdown(ctx context.Context) {
+	s.logger.Println("Shutting down...")
+	s.health.shutdown()
+	s.broker.Close()
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			s.logger.Printf("Failed to drain listener: %s", err)
+		}
+	}
+	if s.grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			s.grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			s.grpcServer.Stop()
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		for _, src := range s.sources {
+			if err := src.Close(); err != nil {
+				s.logger.Printf("Failed to close source %s: %s", src.Name(), err)
+			}
+		}
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		s.logger.Println("Shutdown complete")
+	case <-ctx.Done():
+		s.logger.Println("Shutdown deadline exceeded, exiting")
+	}
+}
+
+// route publishes msg to the stream of the service it belongs to and updates the ingestion metrics
+func (s *ctailserver) route(msg *Message) {
+	service := ExtractFirst(msg.Value, s.routeFields)
+	owner := ExtractFirst(msg.Value, s.ownerFields)
+	if owner == "" {
+		owner = "none"
+	}
+	_, proxied := msg.source.(*peerSource)
+	event := IsEvent(msg.Value)
+	etype := messageType(event)
+	if service != "" {
+		s.broker.Publish(service, msg.Value, event, !proxied)
+		if s.registry.record(service, owner, etype, msg.Topic, msg.Partition, time.Now()) {
+			if s.verbose {
+				s.logger.Printf("Registered new service '%s' found in message: '%s'", service, msg.Value)
+			}
+		}
+		s.ingested.With(prometheus.Labels{"service": service, "owner": owner, "type": etype}).Inc()
+	} else {
+		s.broker.Publish("none", msg.Value, event, !proxied)
+		s.ingested.With(prometheus.Labels{"service": "none", "owner": owner, "type": etype}).Inc()
+	}
+}
+
+func NewCtailServer(verbose bool, bufferSize int, replaySize int, serviceTTL time.Duration) ctailserver {
 	server := ctailserver{}
+	server.capabilities = append([]string{}, defaultCapabilities...)
 	server.ingested = *prometheus.NewCounterVec(prometheus.CounterOpts{
 		Name: "ctail_ingested_logs",
 		Help: "Number of ingested logs by this ctail server since startup(per service).",
@@ -137,13 +526,16 @@ func NewCtailServer(verbose bool, bufferSize int) ctailserver {
 		[]string{"error"})
 	prometheus.MustRegister(server.ingested)
 	prometheus.MustRegister(server.errors)
-	server.errors.With(prometheus.Labels{"error": "kafka_consumption"}).Add(0)
 	server.errors.With(prometheus.Labels{"error": "kafka_rebalance"}).Add(0)
 	server.logger = *log.New(os.Stderr, "", log.LstdFlags)
-	server.server = *sse.New()
+	server.broker = newBroker(bufferSize, replaySize)
+	prometheus.MustRegister(server.broker.dropped, server.broker.subscribers, server.broker.published, server.broker.sentBytes)
 	server.mux = *http.NewServeMux()
-	server.services = []string{}
+	server.registry = newRegistry(serviceTTL)
+	server.health = newHealth()
 	server.bufferSize = bufferSize
+	server.routeFields = ParsePaths("app")
+	server.ownerFields = ParsePaths("owner,obowner")
 	server.verbose = verbose
 
 	return server
@@ -153,15 +545,15 @@ func LocateString(field string, byteArr []byte) int {
 	return bytes.Index(byteArr, []byte(field))
 }
 
+// ExtractString returns the string value of a top level field of the json message
 func ExtractString(field string, byteArr []byte) string {
-	field = "\"" + field + "\":\""
-	ind := bytes.Index(byteArr, []byte(field))
-	if ind == -1 {
-		return ""
-	}
-	ind += len(field)
-	to := bytes.IndexByte(byteArr[ind:], byte('"'))
-	return string(byteArr[ind:(ind + to)])
+	val, _ := ExtractPath(byteArr, []string{field})
+	return val
+}
+
+// IsEvent returns true if the message is an event, that is its tags include EVENT, a log otherwise
+func IsEvent(byteArr []byte) bool {
+	return StringExists("EVENT", ExtractStrings(byteArr, []string{"tags"}))
 }
 
 func StringExists(s string, slice []string) bool {
@@ -0,0 +1,340 @@
+package ctailserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteTimeout = 10 * time.Second
+	wsPingInterval = 30 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// browser dashboards are served from other origins, same as the event streams
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsFrame is a json text frame sent to WebSocket subscribers. Type is "message" for stream messages,
+// otherwise the name of the control event(ctail-gap, ctail-shutdown, ctail-rebalance) or "error".
+type wsFrame struct {
+	Type   string          `json:"type"`
+	Stream string          `json:"stream,omitempty"`
+	ID     string          `json:"id,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// wsControl is a control message sent by WebSocket subscribers:
+//
+//	{"action":"subscribe","stream":"<service>","filter":{"level":"ERROR"},"since":"<event id or RFC3339>"}
+//	{"action":"unsubscribe","stream":"<service>"}
+//	{"action":"filter","stream":"<service>","filter":{"pod":"pod1,pod2"}}
+//	{"action":"pause"} and {"action":"resume"}
+type wsControl struct {
+	Action string            `json:"action"`
+	Stream string            `json:"stream"`
+	Filter map[string]string `json:"filter"`
+	Since  string            `json:"since"`
+}
+
+// wsSubscription is a stream subscription of a WebSocket connection, last is the id of the last message written
+// so a resume after pause continues from it through the replay buffer.
+type wsSubscription struct {
+	sub    *subscriber
+	filter filter
+	last   uint64
+	stop   chan struct{}
+}
+
+// wsDelivery is a message of a subscription forwarded to the connection writer.
+type wsDelivery struct {
+	sub        *subscriber
+	msg        *message
+	disconnect bool // the subscriber was too slow, the connection is closed after msg
+}
+
+// WSHandler streams the same per-service streams as HTTPHandler over a WebSocket, the stream, filter and since
+// query parameters open the first subscription and control messages change the subscriptions without reconnecting.
+func (b *broker) WSHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-b.closing:
+		http.Error(w, "Server is shutting down", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // the upgrader already replied
+	}
+	defer conn.Close()
+
+	controls := make(chan wsControl)
+	readErr := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			control := wsControl{}
+			if err := conn.ReadJSON(&control); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case controls <- control:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	ws := &wsConn{
+		ctx:           r.Context(),
+		remote:        r.RemoteAddr,
+		broker:        b,
+		conn:          conn,
+		subscriptions: make(map[string]*wsSubscription),
+		deliveries:    make(chan wsDelivery, b.bufferSize),
+	}
+	defer ws.unsubscribeAll()
+
+	query := r.URL.Query()
+	if stream := query.Get("stream"); stream != "" {
+		since := r.Header.Get("Last-Event-ID")
+		if since == "" {
+			since = query.Get("since")
+		}
+		if err := ws.subscribe(stream, parseFilter(query), since); err != nil {
+			ws.write(wsFrame{Type: "error", Stream: stream, Error: err.Error()})
+			return
+		}
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case d := <-ws.deliveries:
+			if err := ws.deliver(d); err != nil {
+				return
+			}
+		case control := <-controls:
+			if err := ws.control(control); err != nil {
+				if ws.write(wsFrame{Type: "error", Stream: control.Stream, Error: err.Error()}) != nil {
+					return
+				}
+			}
+		case <-ping.C:
+			if conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)) != nil {
+				return
+			}
+		case <-b.closing:
+			ws.write(wsFrame{Type: shutdownEvent, Data: json.RawMessage(`"server-shutting-down"`)})
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"), time.Now().Add(wsWriteTimeout))
+			return
+		case <-readErr:
+			return
+		}
+	}
+}
+
+// wsConn is the state of a single WebSocket connection, it is only used by the connection goroutine.
+type wsConn struct {
+	ctx           context.Context
+	remote        string
+	broker        *broker
+	conn          *websocket.Conn
+	subscriptions map[string]*wsSubscription
+	deliveries    chan wsDelivery
+	paused        bool
+	pausedAt      time.Time
+}
+
+func (ws *wsConn) control(control wsControl) error {
+	switch control.Action {
+	case "subscribe":
+		if control.Stream == "" {
+			return fmt.Errorf("stream is required")
+		}
+		return ws.subscribe(control.Stream, filterOf(control.Filter), control.Since)
+	case "unsubscribe":
+		if _, ok := ws.subscriptions[control.Stream]; !ok {
+			return fmt.Errorf("not subscribed to %s", control.Stream)
+		}
+		ws.unsubscribe(control.Stream)
+		delete(ws.subscriptions, control.Stream)
+	case "filter":
+		s, ok := ws.subscriptions[control.Stream]
+		if !ok {
+			return fmt.Errorf("not subscribed to %s", control.Stream)
+		}
+		s.filter = filterOf(control.Filter)
+		if s.sub != nil {
+			ws.broker.setFilter(s.sub, s.filter)
+		}
+	case "pause":
+		if !ws.paused {
+			ws.paused = true
+			ws.pausedAt = time.Now()
+			for stream := range ws.subscriptions {
+				ws.unsubscribe(stream)
+			}
+		}
+	case "resume":
+		if ws.paused {
+			ws.paused = false
+			for stream, s := range ws.subscriptions {
+				since := resumePoint{epoch: ws.broker.epoch, id: s.last}
+				if s.last == 0 {
+					since = resumePoint{time: ws.pausedAt}
+				}
+				if err := ws.start(stream, s, since); err != nil {
+					return err
+				}
+			}
+		}
+	default:
+		return fmt.Errorf("unknown action: %s", control.Action)
+	}
+	return nil
+}
+
+// subscribe adds a subscription to stream, replacing an existing one, while paused it only starts on resume.
+func (ws *wsConn) subscribe(stream string, f filter, since string) error {
+	resume, err := parseResumePoint(since)
+	if err != nil {
+		return err
+	}
+	if ws.broker.authorize != nil && !ws.broker.authorize(ws.ctx, stream) {
+		return fmt.Errorf("not authorized to tail %s", stream)
+	}
+	if _, ok := ws.subscriptions[stream]; ok {
+		ws.unsubscribe(stream)
+	}
+	s := &wsSubscription{filter: f}
+	ws.subscriptions[stream] = s
+	if ws.paused {
+		return nil
+	}
+	return ws.start(stream, s, resume)
+}
+
+// start subscribes s to the broker, writes the gap and replayed messages and forwards the new ones.
+func (ws *wsConn) start(stream string, s *wsSubscription, since resumePoint) error {
+	sub, replayed, missed := ws.broker.subscribe(stream, s.filter, since, newConnInfo(ws.ctx, ws.remote, "ws"))
+	s.sub = sub
+	s.stop = make(chan struct{})
+	if missed != 0 {
+		if err := ws.write(wsFrame{Type: gapEvent, Stream: stream, Data: json.RawMessage(fmt.Sprintf("{\"missed\":%d}", missed))}); err != nil {
+			return err
+		}
+	}
+	for _, msg := range replayed {
+		if s.filter == nil || s.filter.match(msg) {
+			if err := ws.deliver(wsDelivery{sub: sub, msg: msg}); err != nil {
+				return err
+			}
+		}
+	}
+	go func(stop chan struct{}) {
+		for {
+			select {
+			case msg := <-sub.messages:
+				select {
+				case ws.deliveries <- wsDelivery{sub: sub, msg: msg}:
+				case <-stop:
+					return
+				}
+			case msg := <-sub.control:
+				select {
+				case ws.deliveries <- wsDelivery{sub: sub, msg: msg}:
+				case <-stop:
+					return
+				}
+			case <-sub.overflowed:
+				dropped, disconnected := ws.broker.takeDropped(sub)
+				select {
+				case ws.deliveries <- wsDelivery{sub: sub, msg: droppedNotice(dropped), disconnect: disconnected}:
+				case <-stop:
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}(s.stop)
+	return nil
+}
+
+// unsubscribe stops the broker subscription of stream, the subscription itself is kept for resume.
+func (ws *wsConn) unsubscribe(stream string) {
+	s := ws.subscriptions[stream]
+	if s.sub == nil {
+		return
+	}
+	close(s.stop)
+	ws.broker.unsubscribe(s.sub)
+	s.sub = nil
+}
+
+func (ws *wsConn) unsubscribeAll() {
+	for stream := range ws.subscriptions {
+		ws.unsubscribe(stream)
+	}
+}
+
+// deliver writes a message of a subscription, messages of subscriptions closed since are dropped.
+func (ws *wsConn) deliver(d wsDelivery) error {
+	stream := d.sub.stream
+	s, ok := ws.subscriptions[stream]
+	if !ok || s.sub != d.sub {
+		return nil
+	}
+	frame := wsFrame{Type: "message", Stream: stream, Data: jsonData(d.msg.data)}
+	if d.msg.name != "" {
+		frame.Type = d.msg.name
+	}
+	if d.msg.id > 0 {
+		frame.ID = eventID(ws.broker.epoch, d.msg.id)
+		s.last = d.msg.id
+	}
+	if err := ws.write(frame); err != nil {
+		return err
+	}
+	ws.broker.delivered(d.sub, d.msg)
+	if d.disconnect {
+		return fmt.Errorf("subscriber of %s too slow", stream)
+	}
+	return nil
+}
+
+func (ws *wsConn) write(frame wsFrame) error {
+	ws.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return ws.conn.WriteJSON(frame)
+}
+
+// filterOf builds a subscriber filter from the filter of a control message, keyed like the query parameters.
+func filterOf(params map[string]string) filter {
+	query := url.Values{}
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	return parseFilter(query)
+}
+
+// jsonData embeds data as is when it is valid json, otherwise as a json string.
+func jsonData(data []byte) json.RawMessage {
+	if json.Valid(data) {
+		return json.RawMessage(data)
+	}
+	quoted, _ := json.Marshal(string(data))
+	return json.RawMessage(quoted)
+}
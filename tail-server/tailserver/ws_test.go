@@ -0,0 +1,84 @@
+package ctailserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// waitSubscribers waits up to a second for stream to have count subscribers
+func waitSubscribers(t *testing.T, b *broker, stream string, count int) {
+	deadline := time.Now().Add(time.Second)
+	for b.subscriberCounts()[stream] != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d subscribers of %s, want %d", b.subscriberCounts()[stream], stream, count)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWSHandler(t *testing.T) {
+	b := newBroker(10, 10)
+	server := httptest.NewServer(http.HandlerFunc(b.WSHandler))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws?stream=svc&level=ERROR", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	waitSubscribers(t, b, "svc", 1)
+
+	read := func(want wsFrame) {
+		t.Helper()
+		got := wsFrame{}
+		if err := conn.ReadJSON(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != want.Type || got.Stream != want.Stream || got.ID != want.ID || string(got.Data) != string(want.Data) || got.Error != want.Error {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+	send := func(control string) {
+		t.Helper()
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(control)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b.Publish("svc", []byte(`{"level":"INFO"}`), false, true)
+	b.Publish("svc", []byte(`{"level":"ERROR","n":1}`), false, true)
+	read(wsFrame{Type: "message", Stream: "svc", ID: eventID(b.epoch, 2), Data: []byte(`{"level":"ERROR","n":1}`)})
+
+	// paused messages are replayed from the last written one on resume
+	send(`{"action":"pause"}`)
+	waitSubscribers(t, b, "svc", 0)
+	b.Publish("svc", []byte(`{"level":"ERROR","n":2}`), false, true)
+	send(`{"action":"resume"}`)
+	read(wsFrame{Type: "message", Stream: "svc", ID: eventID(b.epoch, 3), Data: []byte(`{"level":"ERROR","n":2}`)})
+
+	send(`{"action":"filter","stream":"svc","filter":{"level":"INFO"}}`)
+	send(`{"action":"unsubscribe","stream":"other"}`)
+	read(wsFrame{Type: "error", Stream: "other", Error: "not subscribed to other"})
+	b.Publish("svc", []byte(`{"level":"ERROR","n":3}`), false, true)
+	b.Publish("svc", []byte(`{"level":"INFO","n":4}`), false, true)
+	read(wsFrame{Type: "message", Stream: "svc", ID: eventID(b.epoch, 5), Data: []byte(`{"level":"INFO","n":4}`)})
+
+	b.Broadcast(rebalanceEvent, []byte(`{}`))
+	read(wsFrame{Type: rebalanceEvent, Stream: "svc", Data: []byte(`{}`)})
+
+	send(`{"action":"subscribe","stream":"other","since":"yesterday"}`)
+	got := wsFrame{}
+	if err := conn.ReadJSON(&got); err != nil || got.Type != "error" || got.Stream != "other" {
+		t.Errorf("got %+v, %v - want an error for the invalid since", got, err)
+	}
+	send(`{"action":"jump"}`)
+	read(wsFrame{Type: "error", Error: "unknown action: jump"})
+
+	send(`{"action":"unsubscribe","stream":"svc"}`)
+	waitSubscribers(t, b, "svc", 0)
+}
@@ -0,0 +1,741 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: tail.proto
+
+// Package ctail is the typed streaming API of tail-server, for programmatic consumers
+// that would rather not parse server-sent events.
+
+package tailpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Event_Type int32
+
+const (
+	Event_LOG   Event_Type = 0
+	Event_EVENT Event_Type = 1
+	// some messages were missed on resume, see missed
+	Event_GAP Event_Type = 2
+	// the kafka partitions moved between servers, payload holds the new assignment of this server
+	Event_REBALANCE Event_Type = 3
+	// the subscriber was too slow and missed messages were dropped, see missed
+	Event_DROPPED Event_Type = 4
+)
+
+// Enum value maps for Event_Type.
+var (
+	Event_Type_name = map[int32]string{
+		0: "LOG",
+		1: "EVENT",
+		2: "GAP",
+		3: "REBALANCE",
+		4: "DROPPED",
+	}
+	Event_Type_value = map[string]int32{
+		"LOG":       0,
+		"EVENT":     1,
+		"GAP":       2,
+		"REBALANCE": 3,
+		"DROPPED":   4,
+	}
+)
+
+func (x Event_Type) Enum() *Event_Type {
+	p := new(Event_Type)
+	*p = x
+	return p
+}
+
+func (x Event_Type) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Event_Type) Descriptor() protoreflect.EnumDescriptor {
+	return file_tail_proto_enumTypes[0].Descriptor()
+}
+
+func (Event_Type) Type() protoreflect.EnumType {
+	return &file_tail_proto_enumTypes[0]
+}
+
+func (x Event_Type) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Event_Type.Descriptor instead.
+func (Event_Type) EnumDescriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{7, 0}
+}
+
+// Filter selects messages by their kubernetes metadata and level, every non empty field must match one of its values.
+type Filter struct {
+	state    protoimpl.MessageState `protogen:"open.v1"`
+	Pods     []string               `protobuf:"bytes,1,rep,name=pods,proto3" json:"pods,omitempty"`
+	PodIds   []string               `protobuf:"bytes,2,rep,name=pod_ids,json=podIds,proto3" json:"pod_ids,omitempty"`
+	Envs     []string               `protobuf:"bytes,3,rep,name=envs,proto3" json:"envs,omitempty"`
+	Revs     []string               `protobuf:"bytes,4,rep,name=revs,proto3" json:"revs,omitempty"`
+	Clusters []string               `protobuf:"bytes,5,rep,name=clusters,proto3" json:"clusters,omitempty"`
+	Levels   []string               `protobuf:"bytes,6,rep,name=levels,proto3" json:"levels,omitempty"`
+	// LOG and/or EVENT, all the types when empty
+	Types         []Event_Type `protobuf:"varint,7,rep,packed,name=types,proto3,enum=ctail.Event_Type" json:"types,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Filter) Reset() {
+	*x = Filter{}
+	mi := &file_tail_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Filter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Filter) ProtoMessage() {}
+
+func (x *Filter) ProtoReflect() protoreflect.Message {
+	mi := &file_tail_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Filter.ProtoReflect.Descriptor instead.
+func (*Filter) Descriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Filter) GetPods() []string {
+	if x != nil {
+		return x.Pods
+	}
+	return nil
+}
+
+func (x *Filter) GetPodIds() []string {
+	if x != nil {
+		return x.PodIds
+	}
+	return nil
+}
+
+func (x *Filter) GetEnvs() []string {
+	if x != nil {
+		return x.Envs
+	}
+	return nil
+}
+
+func (x *Filter) GetRevs() []string {
+	if x != nil {
+		return x.Revs
+	}
+	return nil
+}
+
+func (x *Filter) GetClusters() []string {
+	if x != nil {
+		return x.Clusters
+	}
+	return nil
+}
+
+func (x *Filter) GetLevels() []string {
+	if x != nil {
+		return x.Levels
+	}
+	return nil
+}
+
+func (x *Filter) GetTypes() []Event_Type {
+	if x != nil {
+		return x.Types
+	}
+	return nil
+}
+
+type ListServicesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListServicesRequest) Reset() {
+	*x = ListServicesRequest{}
+	mi := &file_tail_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListServicesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListServicesRequest) ProtoMessage() {}
+
+func (x *ListServicesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tail_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListServicesRequest.ProtoReflect.Descriptor instead.
+func (*ListServicesRequest) Descriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{1}
+}
+
+type Service struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Name      string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Owner     string                 `protobuf:"bytes,2,opt,name=owner,proto3" json:"owner,omitempty"`
+	FirstSeen *timestamppb.Timestamp `protobuf:"bytes,3,opt,name=first_seen,json=firstSeen,proto3" json:"first_seen,omitempty"`
+	LastSeen  *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"`
+	Logs      uint64                 `protobuf:"varint,5,opt,name=logs,proto3" json:"logs,omitempty"`
+	Events    uint64                 `protobuf:"varint,6,opt,name=events,proto3" json:"events,omitempty"`
+	// messages per second
+	Rate          float64 `protobuf:"fixed64,7,opt,name=rate,proto3" json:"rate,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Service) Reset() {
+	*x = Service{}
+	mi := &file_tail_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Service) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Service) ProtoMessage() {}
+
+func (x *Service) ProtoReflect() protoreflect.Message {
+	mi := &file_tail_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Service.ProtoReflect.Descriptor instead.
+func (*Service) Descriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Service) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Service) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Service) GetFirstSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.FirstSeen
+	}
+	return nil
+}
+
+func (x *Service) GetLastSeen() *timestamppb.Timestamp {
+	if x != nil {
+		return x.LastSeen
+	}
+	return nil
+}
+
+func (x *Service) GetLogs() uint64 {
+	if x != nil {
+		return x.Logs
+	}
+	return 0
+}
+
+func (x *Service) GetEvents() uint64 {
+	if x != nil {
+		return x.Events
+	}
+	return 0
+}
+
+func (x *Service) GetRate() float64 {
+	if x != nil {
+		return x.Rate
+	}
+	return 0
+}
+
+type ListServicesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Services      []*Service             `protobuf:"bytes,1,rep,name=services,proto3" json:"services,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListServicesResponse) Reset() {
+	*x = ListServicesResponse{}
+	mi := &file_tail_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListServicesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListServicesResponse) ProtoMessage() {}
+
+func (x *ListServicesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tail_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListServicesResponse.ProtoReflect.Descriptor instead.
+func (*ListServicesResponse) Descriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ListServicesResponse) GetServices() []*Service {
+	if x != nil {
+		return x.Services
+	}
+	return nil
+}
+
+type SubscribeRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Service string                 `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Filter  *Filter                `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+	// resume after an event id or from an RFC3339 time, through the replay buffer
+	Since         string `protobuf:"bytes,3,opt,name=since,proto3" json:"since,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SubscribeRequest) Reset() {
+	*x = SubscribeRequest{}
+	mi := &file_tail_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SubscribeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribeRequest) ProtoMessage() {}
+
+func (x *SubscribeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tail_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribeRequest.ProtoReflect.Descriptor instead.
+func (*SubscribeRequest) Descriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *SubscribeRequest) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *SubscribeRequest) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *SubscribeRequest) GetSince() string {
+	if x != nil {
+		return x.Since
+	}
+	return ""
+}
+
+type GetRecentRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Service string                 `protobuf:"bytes,1,opt,name=service,proto3" json:"service,omitempty"`
+	Filter  *Filter                `protobuf:"bytes,2,opt,name=filter,proto3" json:"filter,omitempty"`
+	// the maximum number of messages, 0 returns all the retained messages
+	Limit         int32 `protobuf:"varint,3,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRecentRequest) Reset() {
+	*x = GetRecentRequest{}
+	mi := &file_tail_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecentRequest) ProtoMessage() {}
+
+func (x *GetRecentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tail_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecentRequest.ProtoReflect.Descriptor instead.
+func (*GetRecentRequest) Descriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetRecentRequest) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *GetRecentRequest) GetFilter() *Filter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *GetRecentRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type GetRecentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Events        []*Event               `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetRecentResponse) Reset() {
+	*x = GetRecentResponse{}
+	mi := &file_tail_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetRecentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetRecentResponse) ProtoMessage() {}
+
+func (x *GetRecentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tail_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetRecentResponse.ProtoReflect.Descriptor instead.
+func (*GetRecentResponse) Descriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetRecentResponse) GetEvents() []*Event {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+type Event struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// <epoch>-<seq>, to resume from with SubscribeRequest.since
+	Id      string     `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Service string     `protobuf:"bytes,2,opt,name=service,proto3" json:"service,omitempty"`
+	Owner   string     `protobuf:"bytes,3,opt,name=owner,proto3" json:"owner,omitempty"`
+	Type    Event_Type `protobuf:"varint,4,opt,name=type,proto3,enum=ctail.Event_Type" json:"type,omitempty"`
+	// the raw message as consumed
+	Payload  []byte                 `protobuf:"bytes,5,opt,name=payload,proto3" json:"payload,omitempty"`
+	Received *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=received,proto3" json:"received,omitempty"`
+	// the number of missed messages of a GAP event(-1 when unknown) or of dropped messages of a DROPPED event
+	Missed        int64 `protobuf:"varint,7,opt,name=missed,proto3" json:"missed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_tail_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_tail_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_tail_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Event) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Event) GetService() string {
+	if x != nil {
+		return x.Service
+	}
+	return ""
+}
+
+func (x *Event) GetOwner() string {
+	if x != nil {
+		return x.Owner
+	}
+	return ""
+}
+
+func (x *Event) GetType() Event_Type {
+	if x != nil {
+		return x.Type
+	}
+	return Event_LOG
+}
+
+func (x *Event) GetPayload() []byte {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *Event) GetReceived() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Received
+	}
+	return nil
+}
+
+func (x *Event) GetMissed() int64 {
+	if x != nil {
+		return x.Missed
+	}
+	return 0
+}
+
+var File_tail_proto protoreflect.FileDescriptor
+
+const file_tail_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"tail.proto\x12\x05ctail\x1a\x1fgoogle/protobuf/timestamp.proto\"\xba\x01\n" +
+	"\x06Filter\x12\x12\n" +
+	"\x04pods\x18\x01 \x03(\tR\x04pods\x12\x17\n" +
+	"\apod_ids\x18\x02 \x03(\tR\x06podIds\x12\x12\n" +
+	"\x04envs\x18\x03 \x03(\tR\x04envs\x12\x12\n" +
+	"\x04revs\x18\x04 \x03(\tR\x04revs\x12\x1a\n" +
+	"\bclusters\x18\x05 \x03(\tR\bclusters\x12\x16\n" +
+	"\x06levels\x18\x06 \x03(\tR\x06levels\x12'\n" +
+	"\x05types\x18\a \x03(\x0e2\x11.ctail.Event.TypeR\x05types\"\x15\n" +
+	"\x13ListServicesRequest\"\xe7\x01\n" +
+	"\aService\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x14\n" +
+	"\x05owner\x18\x02 \x01(\tR\x05owner\x129\n" +
+	"\n" +
+	"first_seen\x18\x03 \x01(\v2\x1a.google.protobuf.TimestampR\tfirstSeen\x127\n" +
+	"\tlast_seen\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\blastSeen\x12\x12\n" +
+	"\x04logs\x18\x05 \x01(\x04R\x04logs\x12\x16\n" +
+	"\x06events\x18\x06 \x01(\x04R\x06events\x12\x12\n" +
+	"\x04rate\x18\a \x01(\x01R\x04rate\"B\n" +
+	"\x14ListServicesResponse\x12*\n" +
+	"\bservices\x18\x01 \x03(\v2\x0e.ctail.ServiceR\bservices\"i\n" +
+	"\x10SubscribeRequest\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12%\n" +
+	"\x06filter\x18\x02 \x01(\v2\r.ctail.FilterR\x06filter\x12\x14\n" +
+	"\x05since\x18\x03 \x01(\tR\x05since\"i\n" +
+	"\x10GetRecentRequest\x12\x18\n" +
+	"\aservice\x18\x01 \x01(\tR\aservice\x12%\n" +
+	"\x06filter\x18\x02 \x01(\v2\r.ctail.FilterR\x06filter\x12\x14\n" +
+	"\x05limit\x18\x03 \x01(\x05R\x05limit\"9\n" +
+	"\x11GetRecentResponse\x12$\n" +
+	"\x06events\x18\x01 \x03(\v2\f.ctail.EventR\x06events\"\x99\x02\n" +
+	"\x05Event\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x18\n" +
+	"\aservice\x18\x02 \x01(\tR\aservice\x12\x14\n" +
+	"\x05owner\x18\x03 \x01(\tR\x05owner\x12%\n" +
+	"\x04type\x18\x04 \x01(\x0e2\x11.ctail.Event.TypeR\x04type\x12\x18\n" +
+	"\apayload\x18\x05 \x01(\fR\apayload\x126\n" +
+	"\breceived\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\breceived\x12\x16\n" +
+	"\x06missed\x18\a \x01(\x03R\x06missed\"?\n" +
+	"\x04Type\x12\a\n" +
+	"\x03LOG\x10\x00\x12\t\n" +
+	"\x05EVENT\x10\x01\x12\a\n" +
+	"\x03GAP\x10\x02\x12\r\n" +
+	"\tREBALANCE\x10\x03\x12\v\n" +
+	"\aDROPPED\x10\x042\xc5\x01\n" +
+	"\x04Tail\x12G\n" +
+	"\fListServices\x12\x1a.ctail.ListServicesRequest\x1a\x1b.ctail.ListServicesResponse\x124\n" +
+	"\tSubscribe\x12\x17.ctail.SubscribeRequest\x1a\f.ctail.Event0\x01\x12>\n" +
+	"\tGetRecent\x12\x17.ctail.GetRecentRequest\x1a\x18.ctail.GetRecentResponseB Z\x1egithub.com/sciffer/tail/tailpbb\x06proto3"
+
+var (
+	file_tail_proto_rawDescOnce sync.Once
+	file_tail_proto_rawDescData []byte
+)
+
+func file_tail_proto_rawDescGZIP() []byte {
+	file_tail_proto_rawDescOnce.Do(func() {
+		file_tail_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_tail_proto_rawDesc), len(file_tail_proto_rawDesc)))
+	})
+	return file_tail_proto_rawDescData
+}
+
+var file_tail_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_tail_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_tail_proto_goTypes = []any{
+	(Event_Type)(0),               // 0: ctail.Event.Type
+	(*Filter)(nil),                // 1: ctail.Filter
+	(*ListServicesRequest)(nil),   // 2: ctail.ListServicesRequest
+	(*Service)(nil),               // 3: ctail.Service
+	(*ListServicesResponse)(nil),  // 4: ctail.ListServicesResponse
+	(*SubscribeRequest)(nil),      // 5: ctail.SubscribeRequest
+	(*GetRecentRequest)(nil),      // 6: ctail.GetRecentRequest
+	(*GetRecentResponse)(nil),     // 7: ctail.GetRecentResponse
+	(*Event)(nil),                 // 8: ctail.Event
+	(*timestamppb.Timestamp)(nil), // 9: google.protobuf.Timestamp
+}
+var file_tail_proto_depIdxs = []int32{
+	0,  // 0: ctail.Filter.types:type_name -> ctail.Event.Type
+	9,  // 1: ctail.Service.first_seen:type_name -> google.protobuf.Timestamp
+	9,  // 2: ctail.Service.last_seen:type_name -> google.protobuf.Timestamp
+	3,  // 3: ctail.ListServicesResponse.services:type_name -> ctail.Service
+	1,  // 4: ctail.SubscribeRequest.filter:type_name -> ctail.Filter
+	1,  // 5: ctail.GetRecentRequest.filter:type_name -> ctail.Filter
+	8,  // 6: ctail.GetRecentResponse.events:type_name -> ctail.Event
+	0,  // 7: ctail.Event.type:type_name -> ctail.Event.Type
+	9,  // 8: ctail.Event.received:type_name -> google.protobuf.Timestamp
+	2,  // 9: ctail.Tail.ListServices:input_type -> ctail.ListServicesRequest
+	5,  // 10: ctail.Tail.Subscribe:input_type -> ctail.SubscribeRequest
+	6,  // 11: ctail.Tail.GetRecent:input_type -> ctail.GetRecentRequest
+	4,  // 12: ctail.Tail.ListServices:output_type -> ctail.ListServicesResponse
+	8,  // 13: ctail.Tail.Subscribe:output_type -> ctail.Event
+	7,  // 14: ctail.Tail.GetRecent:output_type -> ctail.GetRecentResponse
+	12, // [12:15] is the sub-list for method output_type
+	9,  // [9:12] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
+}
+
+func init() { file_tail_proto_init() }
+func file_tail_proto_init() {
+	if File_tail_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tail_proto_rawDesc), len(file_tail_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   8,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_tail_proto_goTypes,
+		DependencyIndexes: file_tail_proto_depIdxs,
+		EnumInfos:         file_tail_proto_enumTypes,
+		MessageInfos:      file_tail_proto_msgTypes,
+	}.Build()
+	File_tail_proto = out.File
+	file_tail_proto_goTypes = nil
+	file_tail_proto_depIdxs = nil
+}
@@ -0,0 +1,222 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: tail.proto
+
+// Package ctail is the typed streaming API of tail-server, for programmatic consumers
+// that would rather not parse server-sent events.
+
+package tailpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Tail_ListServices_FullMethodName = "/ctail.Tail/ListServices"
+	Tail_Subscribe_FullMethodName    = "/ctail.Tail/Subscribe"
+	Tail_GetRecent_FullMethodName    = "/ctail.Tail/GetRecent"
+)
+
+// TailClient is the client API for Tail service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TailClient interface {
+	// ListServices returns the services known to the server
+	ListServices(ctx context.Context, in *ListServicesRequest, opts ...grpc.CallOption) (*ListServicesResponse, error)
+	// Subscribe streams the messages of a service as they are consumed, until the client cancels
+	// or the server shuts down(UNAVAILABLE)
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Tail_SubscribeClient, error)
+	// GetRecent returns the latest messages of a service retained for replay
+	GetRecent(ctx context.Context, in *GetRecentRequest, opts ...grpc.CallOption) (*GetRecentResponse, error)
+}
+
+type tailClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTailClient(cc grpc.ClientConnInterface) TailClient {
+	return &tailClient{cc}
+}
+
+func (c *tailClient) ListServices(ctx context.Context, in *ListServicesRequest, opts ...grpc.CallOption) (*ListServicesResponse, error) {
+	out := new(ListServicesResponse)
+	err := c.cc.Invoke(ctx, Tail_ListServices_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tailClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (Tail_SubscribeClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Tail_ServiceDesc.Streams[0], Tail_Subscribe_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &tailSubscribeClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Tail_SubscribeClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type tailSubscribeClient struct {
+	grpc.ClientStream
+}
+
+func (x *tailSubscribeClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *tailClient) GetRecent(ctx context.Context, in *GetRecentRequest, opts ...grpc.CallOption) (*GetRecentResponse, error) {
+	out := new(GetRecentResponse)
+	err := c.cc.Invoke(ctx, Tail_GetRecent_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TailServer is the server API for Tail service.
+// All implementations must embed UnimplementedTailServer
+// for forward compatibility
+type TailServer interface {
+	// ListServices returns the services known to the server
+	ListServices(context.Context, *ListServicesRequest) (*ListServicesResponse, error)
+	// Subscribe streams the messages of a service as they are consumed, until the client cancels
+	// or the server shuts down(UNAVAILABLE)
+	Subscribe(*SubscribeRequest, Tail_SubscribeServer) error
+	// GetRecent returns the latest messages of a service retained for replay
+	GetRecent(context.Context, *GetRecentRequest) (*GetRecentResponse, error)
+	mustEmbedUnimplementedTailServer()
+}
+
+// UnimplementedTailServer must be embedded to have forward compatible implementations.
+type UnimplementedTailServer struct {
+}
+
+func (UnimplementedTailServer) ListServices(context.Context, *ListServicesRequest) (*ListServicesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListServices not implemented")
+}
+func (UnimplementedTailServer) Subscribe(*SubscribeRequest, Tail_SubscribeServer) error {
+	return status.Errorf(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedTailServer) GetRecent(context.Context, *GetRecentRequest) (*GetRecentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetRecent not implemented")
+}
+func (UnimplementedTailServer) mustEmbedUnimplementedTailServer() {}
+
+// UnsafeTailServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TailServer will
+// result in compilation errors.
+type UnsafeTailServer interface {
+	mustEmbedUnimplementedTailServer()
+}
+
+func RegisterTailServer(s grpc.ServiceRegistrar, srv TailServer) {
+	s.RegisterService(&Tail_ServiceDesc, srv)
+}
+
+func _Tail_ListServices_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListServicesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailServer).ListServices(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tail_ListServices_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailServer).ListServices(ctx, req.(*ListServicesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Tail_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TailServer).Subscribe(m, &tailSubscribeServer{stream})
+}
+
+type Tail_SubscribeServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type tailSubscribeServer struct {
+	grpc.ServerStream
+}
+
+func (x *tailSubscribeServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Tail_GetRecent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRecentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TailServer).GetRecent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Tail_GetRecent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TailServer).GetRecent(ctx, req.(*GetRecentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Tail_ServiceDesc is the grpc.ServiceDesc for Tail service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Tail_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ctail.Tail",
+	HandlerType: (*TailServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListServices",
+			Handler:    _Tail_ListServices_Handler,
+		},
+		{
+			MethodName: "GetRecent",
+			Handler:    _Tail_GetRecent_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Subscribe",
+			Handler:       _Tail_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tail.proto",
+}